@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/jsonlog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestMeta collects what the access log needs from the middleware and
+// handlers further down the chain, which only see copies of the request.
+type requestMeta struct {
+	clientIP string
+	userId   int64
+	route    string
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// accessLog writes one line per request. Excluded paths are never logged and
+// requests are sampled at the configured rate, except server errors which
+// are always logged.
+func (app *Application) accessLog(next http.Handler) http.Handler {
+	excluded := make(map[string]bool)
+	for _, path := range strings.Split(app.Config.accessLog.exclude, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			excluded[path] = true
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if excluded[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+
+		meta := &requestMeta{}
+		r = app.contextSetRequestMeta(r, meta)
+
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if rec.status < http.StatusInternalServerError && rand.Float64() >= app.Config.accessLog.sample {
+			return
+		}
+
+		fields := []jsonlog.Field{
+			jsonlog.String("method", r.Method),
+			jsonlog.String("route", meta.route),
+			jsonlog.String("path", r.URL.Path),
+			jsonlog.Int("status", rec.status),
+			jsonlog.Int("bytes", rec.bytes),
+			jsonlog.Duration("duration", time.Since(start)),
+			jsonlog.String("client_ip", meta.clientIP),
+		}
+
+		if meta.userId != 0 {
+			fields = append(fields, jsonlog.Int64("user_id", meta.userId))
+		}
+
+		app.Logger.FromContext(r.Context()).Info("request", fields...)
+	})
+}
+
+// recordRoute stores the pattern a handler was registered under, such as
+// /api/v1/movie/:id, so that access log lines group by endpoint. Requests
+// refused before they reach the router are logged without a route.
+func (app *Application) recordRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if meta, ok := app.contextGetRequestMeta(r); ok {
+			meta.route = pattern
+		}
+
+		next(w, r)
+	}
+}
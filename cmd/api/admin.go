@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+)
+
+func (app *Application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+
+	input.Filters.Page = app.readINT(qs, "page", 1, v)
+	input.Filters.PageSize = app.readINT(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilter(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models(r).Users.GetAll(input.Search, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"Users": users, "Metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeUserWithPermissions(w, r, user)
+}
+
+func (app *Application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Activation *bool `json:"activation"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Activation != nil {
+		user.Activation = *input.Activation
+	}
+
+	err = app.models(r).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUserWithPermissions(w, r, user)
+}
+
+func (app *Application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models(r).Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Codes) >= 1, "codes", "must contain at least 1 permission code")
+	for _, code := range input.Codes {
+		v.Check(known.Include(code), "codes", "must only contain known permission codes")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Permissions.AddForUser(user.Id, input.Codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeUserWithPermissions(w, r, user)
+}
+
+func (app *Application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	err := app.models(r).Permissions.RemoveForUser(user.Id, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeUserWithPermissions(w, r, user)
+}
+
+func (app *Application) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models(r).Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (app *Application) writeUserWithPermissions(w http.ResponseWriter, r *http.Request, user *data.User) {
+	permissions, err := app.models(r).Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
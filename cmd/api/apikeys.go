@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app *Application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	key := &data.APIKey{
+		UserId:    user.Id,
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+
+	// A key can never do more than the credentials used to create it.
+	permissions, ok := app.contextGetPermissions(r)
+	if !ok {
+		permissions, err = app.models(r).Permissions.GetAllForUser(user.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+
+	data.ValidateAPIKey(v, key)
+	for _, scope := range key.Scopes {
+		v.Check(permissions.Include(scope), "scopes", "must only contain permissions you hold")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).APIKeys.New(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/api-keys/%d", key.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.models(r).APIKeys.GetAllForUser(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"ApiKeys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models(r).APIKeys.Delete(id, app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_key": fmt.Sprintf("Revoked API Key with id %d", id)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/data"
+	"net/http"
+	"testing"
+)
+
+type testPermissionModel struct {
+	data.PermissionModel
+	users map[int64]data.Permissions
+}
+
+func (m testPermissionModel) GetAllForUser(userId int64) (data.Permissions, error) {
+	return m.users[userId], nil
+}
+
+func (m testPermissionModel) RemoveForUser(userId int64, codes ...string) error {
+	kept := data.Permissions{}
+	for _, code := range m.users[userId] {
+		if !data.Permissions(codes).Include(code) {
+			kept = append(kept, code)
+		}
+	}
+
+	m.users[userId] = kept
+	return nil
+}
+
+type testAPIKeyModel struct {
+	data.APIKeyModel
+	keys  map[string]*data.APIKey
+	users map[int64]*data.User
+}
+
+func (m testAPIKeyModel) GetForKey(plaintext string) (*data.APIKey, *data.User, error) {
+	key, ok := m.keys[plaintext]
+	if !ok {
+		return nil, nil, data.ErrorRecordNotFound
+	}
+
+	return key, m.users[key.UserId], nil
+}
+
+func TestAPIKeyPermissionsFollowTheOwner(t *testing.T) {
+	const plaintext = "rk_abcdefgh_abcdefghijklmnopqrstuvwxyz234567"
+
+	app := newTestApplication(t)
+	app.Models.Movies = newTestMovies()
+
+	permissions := testPermissionModel{users: map[int64]data.Permissions{
+		1: {data.PermissionMoviesWrite},
+	}}
+	app.Models.Permissions = permissions
+
+	app.Models.APIKeys = testAPIKeyModel{
+		keys: map[string]*data.APIKey{
+			plaintext: {Id: 1, UserId: 1, Scopes: []string{data.PermissionMoviesWrite, data.PermissionUsersAdmin}},
+		},
+		users: map[int64]*data.User{
+			1: {Id: 1, Name: "Alice", Activation: true},
+		},
+	}
+
+	patch := func() int {
+		return app.do(http.MethodPatch, "/api/v1/movie/1", "ApiKey "+plaintext, "application/json", `{"year": 1943}`).Code
+	}
+
+	if got := patch(); got != http.StatusOK {
+		t.Fatalf("got status %d with a scope the owner holds; want %d", got, http.StatusOK)
+	}
+
+	// users:admin is among the key's scopes, but the owner doesn't hold it.
+	w := app.do(http.MethodGet, "/api/v1/admin/users", "ApiKey "+plaintext, "", "")
+	assertStatus(t, w, http.StatusForbidden)
+
+	err := permissions.RemoveForUser(1, data.PermissionMoviesWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := patch(); got != http.StatusForbidden {
+		t.Fatalf("got status %d after the owner lost the permission; want %d", got, http.StatusForbidden)
+	}
+}
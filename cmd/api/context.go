@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/jsonlog"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	userContextKey        = contextKey("user")
+	permissionsContextKey = contextKey("permissions")
+	apiKeyContextKey      = contextKey("api_key")
+	clientIPContextKey    = contextKey("client_ip")
+	requestMetaContextKey = contextKey("request_meta")
+	requestIDContextKey   = contextKey("request_id")
+)
+
+func (app *Application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if meta, ok := app.contextGetRequestMeta(r); ok && !user.IsAnonymous() {
+		meta.userId = user.Id
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// contextSetPermissions stores permissions that came with the credentials
+// themselves, such as JWT claims, so they needn't be looked up again.
+func (app *Application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+func (app *Application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetAPIKey(r *http.Request) (*data.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key, ok
+}
+
+func (app *Application) contextSetClientIP(r *http.Request, ip string) *http.Request {
+	if meta, ok := app.contextGetRequestMeta(r); ok {
+		meta.clientIP = ip
+	}
+
+	ctx := context.WithValue(r.Context(), clientIPContextKey, ip)
+	ctx = jsonlog.NewContext(ctx, jsonlog.String("client_ip", ip))
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetClientIP(r *http.Request) string {
+	ip, ok := r.Context().Value(clientIPContextKey).(string)
+	if !ok {
+		panic("missing client ip value in request context")
+	}
+
+	return ip
+}
+
+func (app *Application) contextSetRequestMeta(r *http.Request, meta *requestMeta) *http.Request {
+	ctx := context.WithValue(r.Context(), requestMetaContextKey, meta)
+	return r.WithContext(ctx)
+}
+
+func (app *Application) contextGetRequestMeta(r *http.Request) (*requestMeta, bool) {
+	meta, ok := r.Context().Value(requestMetaContextKey).(*requestMeta)
+	return meta, ok
+}
+
+func (app *Application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	ctx = jsonlog.NewContext(ctx, jsonlog.String("request_id", id))
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns an empty string for requests that didn't pass
+// through the requestID middleware.
+func (app *Application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
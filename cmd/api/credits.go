@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"net/url"
+)
+
+func (app *Application) listMovieCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models(r).Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.loadCredits(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	credits := movie.Credits
+	if credits == nil {
+		credits = []*data.Credit{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"Credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) createMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PersonId     int64  `json:"person_id"`
+		Role         string `json:"role"`
+		BillingOrder int32  `json:"billing_order"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	credit := &data.Credit{
+		MovieId:      id,
+		PersonId:     input.PersonId,
+		Role:         input.Role,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validator.New()
+
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models(r).Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, err = app.models(r).People.Get(credit.PersonId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			v.AddError("person_id", "must refer to an existing person")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models(r).Credits.Insert(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateError):
+			v.AddError("person_id", "already has this role on the movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/credits/%d", credit.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"credit": credit}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateCreditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	credit, err := app.models(r).Credits.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Role         *string `json:"role"`
+		BillingOrder *int32  `json:"billing_order"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Role != nil {
+		credit.Role = *input.Role
+	}
+
+	if input.BillingOrder != nil {
+		credit.BillingOrder = *input.BillingOrder
+	}
+
+	v := validator.New()
+
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Credits.Update(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateError):
+			v.AddError("role", "person already has this role on the movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"credit": credit}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteCreditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models(r).Credits.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"credit": fmt.Sprintf("Deleted Credit with id %d", id)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) readIncludeCredits(qs url.Values, v *validator.Validator) bool {
+	include := app.readCSV(qs, "include", []string{})
+
+	for _, value := range include {
+		v.Check(validator.In(value, "credits"), "include", "Invalid include Value")
+	}
+
+	return validator.In("credits", include...)
+}
+
+func (app *Application) loadCredits(r *http.Request, movies ...*data.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.Id
+	}
+
+	credits, err := app.models(r).Credits.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		movie.Credits = credits[movie.Id]
+	}
+
+	return nil
+}
@@ -2,14 +2,18 @@ package main
 
 import (
 	"fmt"
+	"github.com/root-root1/rest/internal/jsonlog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *Application) LogError(r *http.Request, err error) {
-	app.Logger.PrintError(err, map[string]string{
-		"request-method": r.Method,
-		"request-url":    r.URL.String(),
-	})
+	app.Logger.FromContext(r.Context()).Error(err,
+		jsonlog.String("request-method", r.Method),
+		jsonlog.String("request-url", r.URL.String()),
+	)
 }
 
 func (app *Application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
@@ -50,7 +54,85 @@ func (app *Application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
-func (app *Application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+func (app *Application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
 	message := "Rate Limit Exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+func (app *Application) clientDeniedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Requests from your Address are not Allowed"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("this %s Content-Type is not Supported for the Resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *Application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Patch test Operation Failed, the Resource has been Modified"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Idempotency-Key has Already been used with a Different Request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *Application) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "A Request with this Idempotency-Key is still being Processed. please try Again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Invalid Authentication Credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *Application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "Invalid or Missing Authentication Token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *Application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "You must be Authenticated to Access this Resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *Application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Your User Account must be Activated to Access this Resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Your User Account doesn't have the Necessary Permissions to Access this Resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "This Resource can't be Accessed with an API Key, please use an Authentication Token"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "Account is Temporarily Locked due to too many Failed Login Attempts"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
+
+func (app *Application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "Too many Failed Login Attempts, please try Again Later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *Application) mfaRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "A totp_code or recovery_code is Required for this Account"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/root-root1/rest/internal/validator"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -59,6 +60,43 @@ func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dist in
 	return nil
 }
 
+func (app *Application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &maxBytesError):
+			return nil, fmt.Errorf("Body must not be larger than %d bytes", maxBytes)
+		default:
+			return nil, err
+		}
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("Body must not be Empty")
+	}
+
+	return body, nil
+}
+
+func (app *Application) readMediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+
+	return mediaType
+}
+
 func (app *Application) readIdParam(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -127,3 +165,31 @@ func (app *Application) readINT(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+func (app *Application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	csv := qs.Get(key)
+
+	ids := []int64{}
+	for _, part := range strings.Split(csv, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			v.AddError(key, "must be a comma separated list of Integer Values")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (app *Application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.Logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
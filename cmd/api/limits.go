@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/jsonlog"
+	"github.com/root-root1/rest/internal/limiter"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// limiterSettings is the part of the rate limiter configuration that can be
+// changed while the server runs. It is replaced as a whole, never modified,
+// so requests always see a consistent set.
+type limiterSettings struct {
+	Enabled  bool              `json:"enabled"`
+	Policies *limiter.Policies `json:"policies"`
+}
+
+func (app *Application) setLimiterSettings(logger *jsonlog.Logger, settings *limiterSettings) {
+	app.limits.Store(settings)
+
+	logger.Info("limiter configuration changed",
+		jsonlog.String("event", "limiter.config_changed"),
+		jsonlog.Bool("enabled", settings.Enabled),
+		jsonlog.Any("default", settings.Policies.Default),
+		jsonlog.Int("policies", len(settings.Policies.Policies)),
+		jsonlog.Any("allow", settings.Policies.Allow),
+		jsonlog.Any("deny", settings.Policies.Deny),
+	)
+}
+
+// reloadLimiterOnSIGHUP re-reads the policy file whenever the process gets a
+// SIGHUP. The file replaces any policies set through the admin endpoint, but
+// the enabled switch is left as it is.
+func (app *Application) reloadLimiterOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		policies, err := loadLimitPolicies(app.Config)
+		if err != nil {
+			app.Logger.Error(err, jsonlog.String("event", "limiter.reload_failed"))
+			continue
+		}
+
+		settings := &limiterSettings{
+			Enabled:  app.limits.Load().Enabled,
+			Policies: policies,
+		}
+
+		app.setLimiterSettings(app.Logger.With(jsonlog.String("source", "sighup")), settings)
+	}
+}
+
+func (app *Application) showLimiterHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"limiter": app.limits.Load()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateLimiterHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Enabled  *bool             `json:"enabled"`
+		Default  *limiter.Policy   `json:"default"`
+		Policies *[]limiter.Policy `json:"policies"`
+		Allow    *[]string         `json:"allow"`
+		Deny     *[]string         `json:"deny"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	current := app.limits.Load()
+
+	// The slices are copied because Validate normalises them in place while
+	// requests may still be reading the current ones.
+	settings := &limiterSettings{
+		Enabled: current.Enabled,
+		Policies: &limiter.Policies{
+			Default:  current.Policies.Default,
+			Policies: append([]limiter.Policy(nil), current.Policies.Policies...),
+			Allow:    append([]string(nil), current.Policies.Allow...),
+			Deny:     append([]string(nil), current.Policies.Deny...),
+		},
+	}
+
+	if input.Enabled != nil {
+		settings.Enabled = *input.Enabled
+	}
+	if input.Default != nil {
+		settings.Policies.Default = *input.Default
+	}
+	if input.Policies != nil {
+		settings.Policies.Policies = *input.Policies
+	}
+	if input.Allow != nil {
+		settings.Policies.Allow = *input.Allow
+	}
+	if input.Deny != nil {
+		settings.Policies.Deny = *input.Deny
+	}
+
+	err = settings.Policies.Validate()
+	if err != nil {
+		v := validator.New()
+		v.AddError("limiter", err.Error())
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	logger := app.Logger.FromContext(r.Context()).With(
+		jsonlog.String("source", "admin"),
+		jsonlog.Int64("user_id", app.contextGetUser(r).Id),
+	)
+
+	app.setLimiterSettings(logger, settings)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"limiter": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
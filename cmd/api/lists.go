@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"strconv"
+)
+
+func (app *Application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		UserId: app.contextGetUser(r).Id,
+		Name:   input.Name,
+		Public: input.Public,
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d", list.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := app.models(r).Lists.GetEntries(list.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list.Entries = entries
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name   *string `json:"name"`
+		Public *bool   `json:"public"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models(r).Lists.Delete(list.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": fmt.Sprintf("Deleted List with id %d", list.Id)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) addListMovieHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieId int64 `json:"movie_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.MovieId > 0, "movie_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models(r).Movies.Get(input.MovieId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			v.AddError("movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models(r).Lists.AddMovie(list.Id, input.MovieId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateError):
+			v.AddError("movie_id", "is already on this list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeListEntries(w, r, list, http.StatusCreated)
+}
+
+func (app *Application) removeListMovieHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieId, err := strconv.ParseInt(params.ByName("movie_id"), 10, 64)
+	if err != nil || movieId < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models(r).Lists.RemoveMovie(list.Id, movieId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeListEntries(w, r, list, http.StatusOK)
+}
+
+func (app *Application) reorderListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieIds []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.MovieIds != nil, "movie_ids", "must be provided")
+
+	seen := make(map[int64]bool, len(input.MovieIds))
+	for _, id := range input.MovieIds {
+		v.Check(!seen[id], "movie_ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Lists.Reorder(list.Id, input.MovieIds)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v.AddError("movie_ids", "must contain exactly the movies on the list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeListEntries(w, r, list, http.StatusOK)
+}
+
+func (app *Application) listUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readINT(qs, "page", 1, v)
+	input.Filters.PageSize = app.readINT(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	if data.ValidateFilter(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	includePrivate := app.contextGetUser(r).Id == id
+
+	lists, metadata, err := app.models(r).Lists.GetAllForUser(id, includePrivate, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"Lists": lists, "Metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) writeListEntries(w http.ResponseWriter, r *http.Request, list *data.List, status int) {
+	entries, err := app.models(r).Lists.GetEntries(list.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list.Entries = entries
+
+	err = app.writeJSON(w, status, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readVisibleList loads the list named in the URL. Private lists are reported
+// as not found to everyone but their owner.
+func (app *Application) readVisibleList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	id, err := app.readIdParam(r)
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err := app.models(r).Lists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !list.Public && list.UserId != app.contextGetUser(r).Id {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
+
+func (app *Application) readOwnList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if list.UserId != app.contextGetUser(r).Id {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
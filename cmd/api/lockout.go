@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard tracks failed logins per account and per client IP. Once a key
+// reaches its failure threshold every further failure locks it for twice as
+// long as the previous lockout, up to maxLockout.
+type loginGuard struct {
+	mu       sync.Mutex
+	accounts map[string]*loginAttempts
+	ips      map[string]*loginAttempts
+
+	accountMaxFailures int
+	ipMaxFailures      int
+	lockout            time.Duration
+	maxLockout         time.Duration
+}
+
+func newLoginGuard(accountMaxFailures int, ipMaxFailures int, lockout time.Duration, maxLockout time.Duration) *loginGuard {
+	g := &loginGuard{
+		accounts:           make(map[string]*loginAttempts),
+		ips:                make(map[string]*loginAttempts),
+		accountMaxFailures: accountMaxFailures,
+		ipMaxFailures:      ipMaxFailures,
+		lockout:            lockout,
+		maxLockout:         maxLockout,
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			g.mu.Lock()
+			for key, a := range g.accounts {
+				if time.Since(a.lastFailure) > g.maxLockout && time.Now().After(a.lockedUntil) {
+					delete(g.accounts, key)
+				}
+			}
+			for key, a := range g.ips {
+				if time.Since(a.lastFailure) > g.maxLockout && time.Now().After(a.lockedUntil) {
+					delete(g.ips, key)
+				}
+			}
+			g.mu.Unlock()
+		}
+	}()
+
+	return g
+}
+
+// locked reports how long the account and the IP remain locked. A zero
+// duration means the key is not locked.
+func (g *loginGuard) locked(email string, ip string) (account time.Duration, client time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+
+	if a, found := g.accounts[strings.ToLower(email)]; found && now.Before(a.lockedUntil) {
+		account = a.lockedUntil.Sub(now)
+	}
+
+	if a, found := g.ips[ip]; found && now.Before(a.lockedUntil) {
+		client = a.lockedUntil.Sub(now)
+	}
+
+	return account, client
+}
+
+// fail records a failed login and returns the lockouts it started, if any.
+func (g *loginGuard) fail(email string, ip string) (account time.Duration, client time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	account = g.record(g.accounts, strings.ToLower(email), g.accountMaxFailures)
+	client = g.record(g.ips, ip, g.ipMaxFailures)
+
+	return account, client
+}
+
+func (g *loginGuard) record(attempts map[string]*loginAttempts, key string, maxFailures int) time.Duration {
+	a, found := attempts[key]
+	if !found || time.Since(a.lastFailure) > g.maxLockout {
+		a = &loginAttempts{}
+		attempts[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = time.Now()
+
+	if a.failures < maxFailures {
+		return 0
+	}
+
+	lockout := time.Duration(float64(g.lockout) * math.Pow(2, float64(a.failures-maxFailures)))
+	if lockout > g.maxLockout || lockout <= 0 {
+		lockout = g.maxLockout
+	}
+
+	a.lockedUntil = a.lastFailure.Add(lockout)
+
+	return lockout
+}
+
+// succeed clears the failure history of an account after a good login.
+func (g *loginGuard) succeed(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, strings.ToLower(email))
+}
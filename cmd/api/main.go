@@ -3,21 +3,34 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/root-root1/rest/internal/data"
 	"github.com/root-root1/rest/internal/jsonlog"
+	"github.com/root-root1/rest/internal/jwt"
+	"github.com/root-root1/rest/internal/limiter"
+	"github.com/root-root1/rest/internal/mailer"
+	"github.com/root-root1/rest/internal/realip"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var version = "1.0.0"
 
 type Config struct {
-	Port int
-	Env  string
-	db   struct {
+	Port               int
+	Env                string
+	trustedProxies     string
+	trustedProxyHeader string
+	writeTimeout       time.Duration
+	db                 struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -25,17 +38,93 @@ type Config struct {
 	}
 
 	Limiter struct {
-		rps    float64
-		bust   int
-		enable bool
+		rps      float64
+		bust     int
+		enable   bool
+		store    string
+		policies string
+	}
+
+	log struct {
+		level          string
+		stackTraces    string
+		file           string
+		fileLevel      string
+		fileMaxSize    int64
+		fileRotate     time.Duration
+		fileMaxBackups int
+		fileCompress   bool
+		asyncBuffer    int
+		redact         string
+	}
+
+	accessLog struct {
+		sample  float64
+		exclude string
+	}
+
+	Movie struct {
+		allowUpsert bool
+		maxUpsertId int64
+	}
+
+	Idempotency struct {
+		ttl         time.Duration
+		lockTimeout time.Duration
+	}
+
+	auth struct {
+		mode             string
+		signingKey       string
+		verificationKeys string
+		audience         string
+		issuer           string
+		ttl              time.Duration
+		leeway           time.Duration
+	}
+
+	login struct {
+		maxFailures   int
+		ipMaxFailures int
+		lockout       time.Duration
+		maxLockout    time.Duration
+	}
+
+	mfa struct {
+		issuer string
+	}
+
+	password struct {
+		hasher            string
+		bcryptCost        int
+		argon2Memory      int
+		argon2Iterations  int
+		argon2Parallelism int
+	}
+
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
 	}
 }
 
 type Application struct {
 	Config  Config
 	Logger  *jsonlog.Logger
+	Slog    *slog.Logger
 	Models  data.Models
+	Mailer  mailer.Mailer
 	Version string
+
+	loginGuard  *loginGuard
+	jwtKey      jwt.Key
+	jwtVerifier *jwt.Verifier
+	limiter     limiter.Limiter
+	limits      atomic.Pointer[limiterSettings]
+	ipResolver  *realip.Resolver
 }
 
 func main() {
@@ -51,6 +140,7 @@ func main() {
 
 	flag.IntVar(&cfg.Port, "Port", 8000, "Port Variable by Default 8000")
 	flag.StringVar(&cfg.Env, "Environment Variable", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&cfg.writeTimeout, "write-timeout", 5*time.Second, "Longest the Server Spends Handling a Request and Writing its Response")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("REST_DB_DSN"), "Postgres DSN (Data Source Name)")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 15, "PostgreSQL max open Connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 15, "PostgreSQL max idle Connections")
@@ -58,22 +148,123 @@ func main() {
 	flag.Float64Var(&cfg.Limiter.rps, "limiter-rps", 2, "Rate Limiter Maximum Request per second")
 	flag.IntVar(&cfg.Limiter.bust, "limiter-bust", 4, "Rate Limiter Maximum Bust")
 	flag.BoolVar(&cfg.Limiter.enable, "enable", true, "Enable Rate Limiter")
+	flag.StringVar(&cfg.Limiter.store, "limiter-store", "memory", "Rate Limiter Store (memory|window|postgres)")
+	flag.StringVar(&cfg.Limiter.policies, "limiter-policies", "", "JSON File with per Route and per Identity Rate Limit Policies")
+	flag.StringVar(&cfg.trustedProxies, "trusted-proxies", "", "Comma Separated CIDRs of Proxies whose Forwarding Header is Trusted")
+	flag.StringVar(&cfg.trustedProxyHeader, "trusted-proxy-header", realip.HeaderXForwardedFor, "Forwarding Header Set by the Trusted Proxies (x-forwarded-for|forwarded)")
+	flag.StringVar(&cfg.log.level, "log-level", "info", "Minimum Log Level (debug|info|warn|error|fatal|off)")
+	flag.StringVar(&cfg.log.stackTraces, "log-stack-traces", "error,fatal", "Comma Separated Log Levels that Include a Stack Trace")
+	flag.StringVar(&cfg.log.file, "log-file", "", "Also Write Logs to this File")
+	flag.StringVar(&cfg.log.fileLevel, "log-file-level", "info", "Minimum Log Level for the Log File")
+	flag.Int64Var(&cfg.log.fileMaxSize, "log-file-max-size", 100, "Rotate the Log File once it Reaches this many MB")
+	flag.DurationVar(&cfg.log.fileRotate, "log-file-rotate", 24*time.Hour, "Rotate the Log File after this long, 0 Disables")
+	flag.IntVar(&cfg.log.fileMaxBackups, "log-file-max-backups", 7, "Rotated Log Files to Keep, 0 Keeps all")
+	flag.BoolVar(&cfg.log.fileCompress, "log-file-compress", true, "Gzip Rotated Log Files")
+	flag.StringVar(&cfg.log.redact, "log-redact", strings.Join(jsonlog.DefaultRedactPatterns, ","), "Comma Separated Patterns of Property Keys and URL Query Parameters Masked in Logs")
+	flag.IntVar(&cfg.log.asyncBuffer, "log-async-buffer", 0, "Buffer Log Lines and Write them in the Background, Dropping Lines when Full, 0 Writes Synchronously")
+	flag.Float64Var(&cfg.accessLog.sample, "access-log-sample", 1, "Fraction of Requests Written to the Access Log, Server Errors are always Logged")
+	flag.StringVar(&cfg.accessLog.exclude, "access-log-exclude", "/api/v1/health-check", "Comma Separated Paths never Written to the Access Log")
+	flag.BoolVar(&cfg.Movie.allowUpsert, "movie-put-upsert", false, "Allow PUT to Create a Movie when the Id does not Exist")
+	flag.Int64Var(&cfg.Movie.maxUpsertId, "movie-put-max-id", 1_000_000, "Largest Id PUT may Create a Movie with")
+	flag.DurationVar(&cfg.Idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long Idempotency-Key Responses are Kept for Replay")
+	flag.DurationVar(&cfg.Idempotency.lockTimeout, "idempotency-lock-timeout", 30*time.Second, "How long an Unfinished Idempotency-Key Request Blocks Retries before they may Take it over, must be Longer than the Write Timeout")
+	flag.StringVar(&cfg.auth.mode, "auth-mode", "token", "Authentication Mode (token|jwt)")
+	flag.StringVar(&cfg.auth.signingKey, "jwt-signing-key", "", "JWT Signing Key File (HMAC Secret or Ed25519 PKCS#8 Private Key)")
+	flag.StringVar(&cfg.auth.verificationKeys, "jwt-verification-keys", "", "Comma Separated JWT Verification Key Files Accepted besides the Signing Key")
+	flag.StringVar(&cfg.auth.audience, "jwt-audience", "rest", "JWT Audience")
+	flag.StringVar(&cfg.auth.issuer, "jwt-issuer", "rest", "JWT Issuer")
+	flag.DurationVar(&cfg.auth.ttl, "jwt-ttl", 15*time.Minute, "JWT Lifetime")
+	flag.DurationVar(&cfg.auth.leeway, "jwt-leeway", 30*time.Second, "Allowed Clock Skew when Validating JWTs")
+	flag.IntVar(&cfg.login.maxFailures, "login-max-failures", 5, "Failed Logins per Account before it is Locked")
+	flag.IntVar(&cfg.login.ipMaxFailures, "login-ip-max-failures", 20, "Failed Logins per Client IP before it is Locked")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", time.Minute, "First Lockout Duration, Doubled on every further Failure")
+	flag.DurationVar(&cfg.login.maxLockout, "login-max-lockout", time.Hour, "Maximum Lockout Duration")
+	flag.StringVar(&cfg.mfa.issuer, "totp-issuer", "Rest", "Issuer Shown in Authenticator Apps")
+	flag.StringVar(&cfg.password.hasher, "password-hasher", "bcrypt", "Password Hashing Algorithm (bcrypt|argon2id)")
+	flag.IntVar(&cfg.password.bcryptCost, "bcrypt-cost", 12, "bcrypt Cost for new Password Hashes")
+	flag.IntVar(&cfg.password.argon2Memory, "argon2-memory", 64*1024, "argon2id Memory in KiB")
+	flag.IntVar(&cfg.password.argon2Iterations, "argon2-iterations", 3, "argon2id Iterations")
+	flag.IntVar(&cfg.password.argon2Parallelism, "argon2-parallelism", 2, "argon2id Parallelism")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("REST_SMTP_HOST"), "SMTP Host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP Port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("REST_SMTP_USERNAME"), "SMTP Username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("REST_SMTP_PASSWORD"), "SMTP Password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Rest <no-reply@rest.local>", "SMTP Sender")
 
 	flag.Parse()
 
+	logger, err = newLogger(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	defer logger.Close()
+
+	// A retry may take over an unfinished Idempotency-Key request once its
+	// lock times out. The original request must be over by then, or both
+	// would run, so the lock has to outlast the write timeout.
+	if cfg.Idempotency.lockTimeout <= cfg.writeTimeout {
+		logger.PrintFatal(errors.New("idempotency-lock-timeout must be longer than write-timeout"), nil)
+	}
+
+	// Packages logging through log/slog end up in the same stream.
+	slogger := slog.New(jsonlog.NewHandler(logger))
+	slog.SetDefault(slogger)
+
+	hasher, err := newPasswordHasher(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	data.SetPasswordHasher(hasher)
+
+	jwtKey, jwtVerifier, err := loadJWTKeys(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDb(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	models := data.NewModel(db)
+
+	rateLimiter, err := newLimiter(cfg, models)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	limitPolicies, err := loadLimitPolicies(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	ipResolver, err := realip.New(cfg.trustedProxies, cfg.trustedProxyHeader)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	mailSender, err := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	app := &Application{
 		Config:  cfg,
 		Logger:  logger,
-		Models:  data.NewModel(db),
+		Slog:    slogger,
+		Models:  models,
+		Mailer:  mailSender,
 		Version: version,
-	}
 
-	if err != nil {
-		logger.PrintFatal(err, nil)
+		loginGuard:  newLoginGuard(cfg.login.maxFailures, cfg.login.ipMaxFailures, cfg.login.lockout, cfg.login.maxLockout),
+		jwtKey:      jwtKey,
+		jwtVerifier: jwtVerifier,
+		limiter:     rateLimiter,
+		ipResolver:  ipResolver,
 	}
 
+	app.limits.Store(&limiterSettings{Enabled: cfg.Limiter.enable, Policies: limitPolicies})
+
 	defer func(db *sql.DB) {
 		err := db.Close()
 		if err != nil {
@@ -90,6 +281,61 @@ func main() {
 	}
 }
 
+func newLogger(cfg Config) (*jsonlog.Logger, error) {
+	level, err := jsonlog.ParseLevel(cfg.log.level)
+	if err != nil {
+		return jsonlog.New(os.Stdout, jsonlog.LevelInfo), err
+	}
+
+	outputs := []jsonlog.Output{{Writer: os.Stdout, Minimum: level}}
+
+	if cfg.log.file != "" {
+		fileLevel, err := jsonlog.ParseLevel(cfg.log.fileLevel)
+		if err != nil {
+			return jsonlog.New(os.Stdout, jsonlog.LevelInfo), err
+		}
+
+		file := &jsonlog.RotatingFile{
+			Path:       cfg.log.file,
+			MaxSize:    cfg.log.fileMaxSize * 1024 * 1024,
+			Interval:   cfg.log.fileRotate,
+			MaxBackups: cfg.log.fileMaxBackups,
+			Compress:   cfg.log.fileCompress,
+		}
+
+		outputs = append(outputs, jsonlog.Output{Writer: file, Minimum: fileLevel})
+	}
+
+	if cfg.log.asyncBuffer > 0 {
+		for i := range outputs {
+			outputs[i].Writer = jsonlog.NewAsync(outputs[i].Writer, cfg.log.asyncBuffer)
+		}
+	}
+
+	var traces []jsonlog.Level
+	for _, name := range strings.Split(cfg.log.stackTraces, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		traceLevel, err := jsonlog.ParseLevel(name)
+		if err != nil {
+			return jsonlog.New(os.Stdout, jsonlog.LevelInfo), err
+		}
+		traces = append(traces, traceLevel)
+	}
+
+	redactor, err := jsonlog.NewRedactor(strings.Split(cfg.log.redact, ",")...)
+	if err != nil {
+		return jsonlog.New(os.Stdout, jsonlog.LevelInfo), err
+	}
+
+	logger := jsonlog.NewMulti(outputs...)
+	logger.SetStackTraces(traces...)
+	logger.SetRedactor(redactor)
+
+	return logger, nil
+}
+
 func openDb(cfg Config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 
@@ -119,3 +365,89 @@ func openDb(cfg Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func newPasswordHasher(cfg Config) (data.PasswordHasher, error) {
+	switch cfg.password.hasher {
+	case "bcrypt":
+		if cfg.password.bcryptCost < bcrypt.MinCost || cfg.password.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return data.BcryptHasher{Cost: cfg.password.bcryptCost}, nil
+	case "argon2id":
+		if cfg.password.argon2Memory < 8*cfg.password.argon2Parallelism || cfg.password.argon2Iterations < 1 || cfg.password.argon2Parallelism < 1 || cfg.password.argon2Parallelism > 255 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		return data.Argon2idHasher{
+			Memory:      uint32(cfg.password.argon2Memory),
+			Iterations:  uint32(cfg.password.argon2Iterations),
+			Parallelism: uint8(cfg.password.argon2Parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.password.hasher)
+	}
+}
+
+// newLimiter picks the rate limiter backend. "memory" keeps token buckets
+// per process; "window" and "postgres" use the sliding window limiter, the
+// latter shared by every replica using the same database.
+func newLimiter(cfg Config, models data.Models) (limiter.Limiter, error) {
+	switch cfg.Limiter.store {
+	case "memory":
+		return limiter.NewTokenBucket(), nil
+	case "window":
+		return limiter.NewSlidingWindow(limiter.NewMemoryStore()), nil
+	case "postgres":
+		return limiter.NewSlidingWindow(models.RateLimits), nil
+	default:
+		return nil, fmt.Errorf("unknown limiter store %q", cfg.Limiter.store)
+	}
+}
+
+func loadLimitPolicies(cfg Config) (*limiter.Policies, error) {
+	fallback := limiter.Limit{Rate: cfg.Limiter.rps, Burst: cfg.Limiter.bust}
+
+	if cfg.Limiter.policies == "" {
+		return limiter.DefaultPolicies(fallback), nil
+	}
+
+	return limiter.LoadPolicies(cfg.Limiter.policies, fallback)
+}
+
+func loadJWTKeys(cfg Config) (jwt.Key, *jwt.Verifier, error) {
+	switch cfg.auth.mode {
+	case "token":
+		return jwt.Key{}, nil, nil
+	case "jwt":
+	default:
+		return jwt.Key{}, nil, fmt.Errorf("unknown auth mode %q", cfg.auth.mode)
+	}
+
+	if cfg.auth.signingKey == "" {
+		return jwt.Key{}, nil, errors.New("jwt auth mode requires -jwt-signing-key")
+	}
+
+	signingKey, err := jwt.LoadKey(cfg.auth.signingKey)
+	if err != nil {
+		return jwt.Key{}, nil, err
+	}
+
+	if !signingKey.CanSign() {
+		return jwt.Key{}, nil, errors.New("jwt signing key must be a private key or HMAC secret")
+	}
+
+	keys := []jwt.Key{signingKey}
+
+	if cfg.auth.verificationKeys != "" {
+		for _, path := range strings.Split(cfg.auth.verificationKeys, ",") {
+			key, err := jwt.LoadKey(strings.TrimSpace(path))
+			if err != nil {
+				return jwt.Key{}, nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return signingKey, jwt.NewVerifier(cfg.auth.issuer, cfg.auth.audience, cfg.auth.leeway, keys...), nil
+}
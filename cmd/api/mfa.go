@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/totp"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app *Application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	// The user in the context may come from a JWT without an email, which
+	// the otpauth URI needs as the account name.
+	user, err := app.models(r).Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The secret stays pending until it is confirmed with a code, so an
+	// abandoned enrollment never locks the user out.
+	err = app.models(r).MFA.SetPendingSecret(user.Id, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v := validator.New()
+			v.AddError("mfa", "is already enabled")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"secret":      totp.EncodeSecret(secret),
+		"otpauth_uri": totp.URI(app.Config.mfa.issuer, user.Email, secret),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	mfa, err := app.models(r).MFA.Get(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if mfa.Enabled || mfa.Secret == nil {
+		v.AddError("mfa", "has no pending enrollment")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	counter, ok := totp.Validate(mfa.Secret, input.Code, time.Now(), 1)
+	if !ok {
+		v.AddError("code", "is invalid")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, hashes, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models(r).MFA.Enable(user.Id, counter, hashes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password     string `json:"password"`
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePasswordPlaintext(v, input.Password)
+	v.Check(input.TOTPCode != "" || input.RecoveryCode != "", "totp_code", "or recovery_code must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The user in the context may come from a JWT without a password hash,
+	// so re-authentication always reads the stored record.
+	user, err := app.models(r).Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Guesses here count towards the same lockouts as failed logins, or
+	// this would be a way around them.
+	ip := app.contextGetClientIP(r)
+
+	accountLock, ipLock := app.loginGuard.locked(user.Email, ip)
+	switch {
+	case ipLock > 0:
+		app.tooManyLoginAttemptsResponse(w, r, ipLock)
+		return
+	case accountLock > 0:
+		app.accountLockedResponse(w, r, accountLock)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.failedLoginResponse(w, r, user.Email, user.Id, ip)
+		return
+	}
+
+	mfa, err := app.models(r).MFA.Get(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !mfa.Enabled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(r, mfa, input.TOTPCode, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		app.failedLoginResponse(w, r, user.Email, user.Id, ip)
+		return
+	}
+
+	app.loginGuard.succeed(user.Email)
+
+	err = app.models(r).MFA.Disable(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "multi-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifySecondFactor accepts either a TOTP code, which can be used only once
+// per time step, or an unused recovery code.
+func (app *Application) verifySecondFactor(r *http.Request, mfa *data.MFA, totpCode string, recoveryCode string) (bool, error) {
+	if totpCode != "" {
+		counter, ok := totp.Validate(mfa.Secret, totpCode, time.Now(), 1)
+		if !ok {
+			return false, nil
+		}
+		return app.models(r).MFA.UseCounter(mfa.UserId, counter)
+	}
+
+	if recoveryCode != "" {
+		return app.models(r).MFA.UseRecoveryCode(mfa.UserId, recoveryCode)
+	}
+
+	return false, nil
+}
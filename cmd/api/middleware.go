@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"golang.org/x/time/rate"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/limiter"
+	"github.com/root-root1/rest/internal/validator"
+	"io"
+	"math"
 	"net"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,53 +30,437 @@ func (app *Application) recoverPanic(next http.Handler) http.Handler {
 
 }
 
+// realIP stores the client address, resolved through any trusted proxies, in
+// the request context for everything that needs to tell clients apart.
+func (app *Application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, err := app.ipResolver.ClientIP(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		r = app.contextSetClientIP(r, ip)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// denyListed refuses clients on the limiter deny list before any other work
+// is done for them.
+func (app *Application) denyListed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limits.Load().Policies.Denied(net.ParseIP(app.contextGetClientIP(r))) {
+			app.clientDeniedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter runs after authenticate so that authenticated callers are
+// limited per user or API key rather than per IP, which would otherwise be
+// shared by everyone behind the same NAT. Requests with bad credentials never
+// get here; authenticate charges them to the IP itself.
 func (app *Application) rateLimiter(next http.Handler) http.Handler {
-	type Clients struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := app.limits.Load()
+
+		if !settings.Enabled || settings.Policies.Allowed(net.ParseIP(app.contextGetClientIP(r))) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, key := app.rateLimitIdentity(r)
+
+		policy := settings.Policies.Match(r.Method, r.URL.Path, identity)
+
+		result, err := app.limiter.Allow(policy.Name+"|"+key, policy.Limit())
+		if err != nil {
+			// An unreachable shared store shouldn't take the API down with
+			// it, so requests are let through and the failure is logged.
+			app.LogError(r, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+		if !result.Allowed {
+			app.rateLimitExceededResponse(w, r, result.RetryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ipRateLimit returns the limiter key and limit that anonymous requests from
+// the client IP are counted against. ok is false when the IP isn't limited.
+func (app *Application) ipRateLimit(r *http.Request) (key string, limit limiter.Limit, ok bool) {
+	settings := app.limits.Load()
+	ip := app.contextGetClientIP(r)
+
+	if !settings.Enabled || settings.Policies.Allowed(net.ParseIP(ip)) {
+		return "", limiter.Limit{}, false
 	}
 
-	var (
-		mu     sync.Mutex
-		client = make(map[string]*Clients)
-	)
-
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, c := range client {
-				if time.Since(c.lastSeen) > 3*time.Minute {
-					delete(client, ip)
+	policy := settings.Policies.Match(r.Method, r.URL.Path, limiter.IdentityIP)
+
+	return policy.Name + "|ip:" + ip, policy.Limit(), true
+}
+
+func (app *Application) rateLimitIdentity(r *http.Request) (string, string) {
+	if key, ok := app.contextGetAPIKey(r); ok {
+		return limiter.IdentityAPIKey, fmt.Sprintf("api_key:%d", key.Id)
+	}
+
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		return limiter.IdentityUser, fmt.Sprintf("user:%d", user.Id)
+	}
+
+	return limiter.IdentityIP, "ip:" + app.contextGetClientIP(r)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.header == nil {
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.header == nil {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent replays the stored response to requests repeating an
+// Idempotency-Key. While the first request with a key is in flight, retries
+// get a conflict. They may only take the key over once its lock times out,
+// which main checks is longer than the server's write timeout, so a retry
+// never runs alongside a request still being answered. Handlers wrapped by
+// idempotent must therefore finish within the write timeout.
+func (app *Application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key must not be more than 255 bytes long"))
+			return
+		}
+
+		maxBytes := 1_048_576
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("Body must not be larger than %d bytes", maxBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.New()
+		fingerprint.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n"))
+		fingerprint.Write(body)
+
+		scope := "ip:" + app.contextGetClientIP(r)
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			scope = fmt.Sprintf("user:%d", user.Id)
+		}
+
+		record := &data.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Fingerprint: fingerprint.Sum(nil),
+			ExpiresAt:   time.Now().Add(app.Config.Idempotency.ttl),
+		}
+
+		reserved, err := app.models(r).Idempotency.Reserve(record, app.Config.Idempotency.lockTimeout)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !reserved {
+			stored, err := app.models(r).Idempotency.Get(record.Scope, record.Key, record.Method, record.Path)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrorRecordNotFound):
+					app.idempotencyKeyInProgressResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			switch {
+			case !bytes.Equal(stored.Fingerprint, record.Fingerprint):
+				app.idempotencyKeyMismatchResponse(w, r)
+			case stored.Status == 0:
+				app.idempotencyKeyInProgressResponse(w, r)
+			default:
+				for key, value := range stored.Header {
+					w.Header()[key] = value
 				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
 			}
-			mu.Unlock()
+			return
 		}
-	}()
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+
+		completed := false
+		defer func() {
+			if !completed {
+				err := app.models(r).Idempotency.Delete(record)
+				if err != nil {
+					app.LogError(r, err)
+				}
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.header == nil || rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		record.Status = rec.status
+		record.Header = rec.header
+		record.Body = rec.body.Bytes()
+
+		err = app.models(r).Idempotency.Complete(record)
 		if err != nil {
-			app.serverErrorResponse(w, r, err)
+			app.LogError(r, err)
+			return
+		}
+		completed = true
+	}
+}
+
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.authenticationAllowed(w, r) {
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || (headerParts[0] != "Bearer" && headerParts[0] != "ApiKey") {
+			app.failedAuthenticationResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		if headerParts[0] == "ApiKey" {
+			v := validator.New()
+
+			if data.ValidateAPIKeyPlaintext(v, token); !v.Valid() {
+				app.failedAuthenticationResponse(w, r)
+				return
+			}
+
+			key, user, err := app.models(r).APIKeys.GetForKey(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrorRecordNotFound):
+					app.failedAuthenticationResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			// Scopes were checked against the owner's permissions when the
+			// key was created, but permissions revoked since must not live
+			// on in the key, so only those still held are granted.
+			permissions, err := app.models(r).Permissions.GetAllForUser(user.Id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetPermissions(r, data.Permissions(key.Scopes).Intersect(permissions))
+			r = app.contextSetAPIKey(r, key)
+
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		mu.Lock()
+		if app.Config.auth.mode == "jwt" {
+			claims, err := app.jwtVerifier.Verify(token, time.Now())
+			if err != nil {
+				app.failedAuthenticationResponse(w, r)
+				return
+			}
 
-		if _, found := client[ip]; !found {
-			client[ip] = &Clients{
-				limiter: rate.NewLimiter(rate.Limit(app.Config.Limiter.rps), app.Config.Limiter.bust),
+			id, err := strconv.ParseInt(claims.Subject, 10, 64)
+			if err != nil || id < 1 {
+				app.failedAuthenticationResponse(w, r)
+				return
 			}
+
+			r = app.contextSetUser(r, &data.User{Id: id, Activation: claims.Activated})
+			r = app.contextSetPermissions(r, claims.Permissions)
+
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		client[ip].lastSeen = time.Now()
+		v := validator.New()
 
-		if !client[ip].limiter.Allow() {
-			mu.Unlock()
-			app.rateLimitExceededResponse(w, r)
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.failedAuthenticationResponse(w, r)
 			return
 		}
 
-		mu.Unlock()
+		user, err := app.models(r).Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrorRecordNotFound):
+				app.failedAuthenticationResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticationAllowed refuses credentials from a client IP that has used
+// up its rate limit. authenticate runs before the rate limiter, so without
+// this every guess at a token or API key would cost a database lookup.
+func (app *Application) authenticationAllowed(w http.ResponseWriter, r *http.Request) bool {
+	key, limit, ok := app.ipRateLimit(r)
+	if !ok {
+		return true
+	}
+
+	result, err := app.limiter.Peek(key, limit)
+	if err != nil {
+		app.LogError(r, err)
+		return true
+	}
+
+	if !result.Allowed {
+		app.rateLimitExceededResponse(w, r, result.RetryAfter)
+		return false
+	}
+
+	return true
+}
+
+// failedAuthenticationResponse charges bad credentials to the client IP's
+// rate limit, so guessing tokens is throttled like anonymous requests are.
+func (app *Application) failedAuthenticationResponse(w http.ResponseWriter, r *http.Request) {
+	if key, limit, ok := app.ipRateLimit(r); ok {
+		_, err := app.limiter.Allow(key, limit)
+		if err != nil {
+			app.LogError(r, err)
+		}
+	}
+
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
+func (app *Application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (app *Application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activation {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requireUserCredentials refuses requests authenticated with an API key. It
+// guards routes that manage the account itself, such as minting more keys,
+// which no key may do whatever its scopes.
+func (app *Application) requireUserCredentials(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetAPIKey(r); ok {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+func (app *Application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+
+			permissions, err = app.models(r).Permissions.GetAllForUser(app.contextGetUser(r).Id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	_ "fmt"
 	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/jsonpatch"
 	"github.com/root-root1/rest/internal/validator"
 	"net/http"
 	"strconv"
@@ -40,7 +43,7 @@ func (app *Application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.Models.Movies.Insert(movie)
+	err = app.models(r).Movies.Insert(movie)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -69,11 +72,19 @@ func (app *Application) getMovieById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	movie, err := app.Models.Movies.Get(id)
+	v := validator.New()
+
+	includeCredits := app.readIncludeCredits(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models(r).Movies.Get(id)
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, data.ErrorRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -81,6 +92,14 @@ func (app *Application) getMovieById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if includeCredits {
+		err = app.loadCredits(r, movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"Movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -101,11 +120,11 @@ func (app *Application) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	movie, err := app.Models.Movies.Get(id)
+	movie, err := app.models(r).Movies.Get(id)
 
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, sql.ErrNoRows), errors.Is(err, data.ErrorRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -120,11 +139,96 @@ func (app *Application) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	v := validator.New()
+
+	switch mediaType := app.readMediaType(r); mediaType {
+	case "", "application/json":
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+
+	case "application/merge-patch+json", "application/json-patch+json":
+		err = app.patchMovie(w, r, mediaType, movie, v)
+		if err != nil {
+			var operationError *jsonpatch.OperationError
+
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r)
+			case errors.As(err, &operationError):
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, operationError.Error())
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Movies.Update(movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) replaceMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -133,30 +237,52 @@ func (app *Application) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+	created := false
 
-	if input.Year != nil {
-		movie.Year = *input.Year
+	movie, err := app.models(r).Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound) && app.Config.Movie.allowUpsert:
+			created = true
+			movie = &data.Movie{Id: id}
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	if !created && r.Header.Get("X-Extended-Version") != "" {
+		if strconv.FormatInt(int64(movie.Version), 32) != r.Header.Get("X-Extended-Version") {
+			app.editConflictResponse(w, r)
+			return
+		}
 	}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
-	}
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
 
 	v := validator.New()
 
+	if created {
+		v.Check(id <= app.Config.Movie.maxUpsertId, "id", fmt.Sprintf("must not be greater than %d", app.Config.Movie.maxUpsertId))
+	}
+
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.Models.Movies.Update(movie)
+	if created {
+		err = app.models(r).Movies.InsertWithId(movie)
+	} else {
+		err = app.models(r).Movies.Update(movie)
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -167,13 +293,83 @@ func (app *Application) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if !created {
+		err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
 
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/movie/%d", movie.Id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+type moviePatchDocument struct {
+	Id      int64        `json:"id"`
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+	Version int32        `json:"version"`
+}
+
+// patchMovie applies a JSON Merge Patch or JSON Patch body to the editable
+// representation of movie. Fields removed by the patch are left at their zero
+// value so that ValidateMovie reports them as missing.
+func (app *Application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie, v *validator.Validator) error {
+	patch, err := app.readBody(w, r)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(moviePatchDocument{
+		Id:      movie.Id,
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+		Version: movie.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	if mediaType == "application/merge-patch+json" {
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	var patched moviePatchDocument
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&patched)
+	if err != nil {
+		return fmt.Errorf("Patched Movie is Invalid: %w", err)
+	}
+
+	v.Check(patched.Id == movie.Id, "id", "must not be changed")
+	v.Check(patched.Version == movie.Version, "version", "must not be changed")
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
+
 func (app *Application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIdParam(r)
 
@@ -188,7 +384,7 @@ func (app *Application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.Models.Movies.Delete(id)
+	err = app.models(r).Movies.Delete(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -207,8 +403,9 @@ func (app *Application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 
 func (app *Application) listMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		Title    string
+		Genres   []string
+		PersonId int64
 		data.Filters
 	}
 
@@ -216,28 +413,129 @@ func (app *Application) listMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	qs := r.URL.Query()
 
+	includeCredits := app.readIncludeCredits(qs, v)
+
+	if qs.Has("ids") {
+		ids := app.readIDs(qs, "ids", v)
+		if validateMovieIds(v, ids); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.writeMovieBatch(w, r, ids, includeCredits)
+		return
+	}
+
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.PersonId = int64(app.readINT(qs, "person", 0, v))
+	v.Check(input.PersonId >= 0, "person", "must be a positive integer")
 
 	input.Filters.Page = app.readINT(qs, "page", 1, v)
 	input.Filters.PageSize = app.readINT(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafeList = []string{
+		"id", "title", "year", "runtime", "average_rating", "rating_count",
+		"-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count",
+	}
 
 	if data.ValidateFilter(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.Models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models(r).Movies.GetAll(input.Title, input.Genres, input.PersonId, input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	if includeCredits {
+		err = app.loadCredits(r, movies...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"Movies": movies, "Metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *Application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Ids []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	includeCredits := app.readIncludeCredits(r.URL.Query(), v)
+
+	if validateMovieIds(v, input.Ids); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.writeMovieBatch(w, r, input.Ids, includeCredits)
+}
+
+func validateMovieIds(v *validator.Validator, ids []int64) {
+	v.Check(len(ids) >= 1, "ids", "must contain at least 1 id")
+	v.Check(len(ids) <= 100, "ids", "must not contain more than 100 ids")
+
+	for _, id := range ids {
+		v.Check(id > 0, "ids", "must only contain positive integers")
+	}
+}
+
+func (app *Application) writeMovieBatch(w http.ResponseWriter, r *http.Request, ids []int64, includeCredits bool) {
+	unique := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	movies, err := app.models(r).Movies.GetMany(unique)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if includeCredits {
+		err = app.loadCredits(r, movies...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	found := make(map[int64]bool, len(movies))
+	for _, movie := range movies {
+		found[movie.Id] = true
+	}
+
+	notFound := []int64{}
+	for _, id := range unique {
+		if !found[id] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"Movies": movies, "NotFound": notFound}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateMovie(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", "/api/v1/movie/1", "application/json", `{"year": 1943}`, http.StatusOK},
+		{"merge patch", "/api/v1/movie/1", "application/merge-patch+json", `{"year": 1943}`, http.StatusOK},
+		{"json patch", "/api/v1/movie/1", "application/json-patch+json", `[{"op": "replace", "path": "/year", "value": 1943}]`, http.StatusOK},
+		{"unknown id json", "/api/v1/movie/2", "application/json", `{"year": 1943}`, http.StatusNotFound},
+		{"unknown id merge patch", "/api/v1/movie/2", "application/merge-patch+json", `{"year": 1943}`, http.StatusNotFound},
+		{"unknown id json patch", "/api/v1/movie/2", "application/json-patch+json", `[{"op": "replace", "path": "/year", "value": 1943}]`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.Models.Movies = newTestMovies()
+
+			w := app.do(http.MethodPatch, tt.path, app.bearer(t, 1, data.PermissionMoviesWrite), tt.contentType, tt.body)
+			assertStatus(t, w, tt.want)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/root-root1/rest/internal/data"
+	"net/http"
+	"regexp"
+)
+
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID takes the X-Request-ID sent by the client or a proxy in front of
+// us, or makes one up, and echoes it in the response so both sides can refer
+// to the same request.
+func (app *Application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !requestIDRX.MatchString(id) {
+			randomBytes := make([]byte, 16)
+
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			id = hex.EncodeToString(randomBytes)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// models returns the models with their queries tagged with the request id.
+func (app *Application) models(r *http.Request) data.Models {
+	if id := app.contextGetRequestID(r); id != "" {
+		return app.Models.WithRequestID(id)
+	}
+
+	return app.Models
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/julienschmidt/httprouter"
+	"github.com/root-root1/rest/internal/data"
 	"net/http"
 )
 
@@ -11,12 +12,69 @@ func (app *Application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowed)
 
-	router.HandlerFunc(http.MethodGet, "/api/v1/health-check", app.healthCheckHandler)
-	router.HandlerFunc(http.MethodPost, "/api/v1/movie", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/api/v1/movie/:id", app.getMovieById)
-	router.HandlerFunc(http.MethodPatch, "/api/v1/movie/:id", app.UpdateMovie)
-	router.HandlerFunc(http.MethodDelete, "/api/v1/movie/:id", app.deleteMovie)
-	router.HandlerFunc(http.MethodGet, "/api/v1/movies", app.listMovieHandler)
+	handle := func(method string, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.recordRoute(pattern, handler))
+	}
 
-	return app.recoverPanic(app.rateLimiter(router))
+	handle(http.MethodGet, "/api/v1/health-check", app.healthCheckHandler)
+	handle(http.MethodPost, "/api/v1/movie", app.requirePermission(data.PermissionMoviesWrite, app.idempotent(app.createMovieHandler)))
+	handle(http.MethodGet, "/api/v1/movie/:id", app.getMovieById)
+	handle(http.MethodPut, "/api/v1/movie/:id", app.requirePermission(data.PermissionMoviesWrite, app.replaceMovieHandler))
+	handle(http.MethodPatch, "/api/v1/movie/:id", app.requirePermission(data.PermissionMoviesWrite, app.UpdateMovie))
+	handle(http.MethodDelete, "/api/v1/movie/:id", app.requirePermission(data.PermissionMoviesWrite, app.deleteMovie))
+	handle(http.MethodGet, "/api/v1/movies", app.listMovieHandler)
+	handle(http.MethodPost, "/api/v1/movies/batch-get", app.batchGetMoviesHandler)
+
+	handle(http.MethodGet, "/api/v1/movie/:id/credits", app.listMovieCreditsHandler)
+	handle(http.MethodPost, "/api/v1/movie/:id/credits", app.requirePermission(data.PermissionMoviesWrite, app.createMovieCreditHandler))
+	handle(http.MethodPatch, "/api/v1/credits/:id", app.requirePermission(data.PermissionMoviesWrite, app.updateCreditHandler))
+	handle(http.MethodDelete, "/api/v1/credits/:id", app.requirePermission(data.PermissionMoviesWrite, app.deleteCreditHandler))
+
+	handle(http.MethodGet, "/api/v1/movie/:id/reviews", app.listMovieReviewsHandler)
+	handle(http.MethodPost, "/api/v1/movie/:id/reviews", app.requireActivatedUser(app.createReviewHandler))
+	handle(http.MethodPatch, "/api/v1/reviews/:id", app.requireActivatedUser(app.updateReviewHandler))
+	handle(http.MethodDelete, "/api/v1/reviews/:id", app.requireActivatedUser(app.deleteReviewHandler))
+
+	handle(http.MethodGet, "/api/v1/people", app.listPeopleHandler)
+	handle(http.MethodPost, "/api/v1/people", app.requirePermission(data.PermissionMoviesWrite, app.createPersonHandler))
+	handle(http.MethodGet, "/api/v1/people/:id", app.showPersonHandler)
+	handle(http.MethodPatch, "/api/v1/people/:id", app.requirePermission(data.PermissionMoviesWrite, app.updatePersonHandler))
+	handle(http.MethodDelete, "/api/v1/people/:id", app.requirePermission(data.PermissionMoviesWrite, app.deletePersonHandler))
+
+	handle(http.MethodPost, "/api/v1/lists", app.requireActivatedUser(app.createListHandler))
+	handle(http.MethodGet, "/api/v1/lists/:id", app.showListHandler)
+	handle(http.MethodPatch, "/api/v1/lists/:id", app.requireActivatedUser(app.updateListHandler))
+	handle(http.MethodDelete, "/api/v1/lists/:id", app.requireActivatedUser(app.deleteListHandler))
+	handle(http.MethodPost, "/api/v1/lists/:id/movies", app.requireActivatedUser(app.addListMovieHandler))
+	handle(http.MethodPut, "/api/v1/lists/:id/movies", app.requireActivatedUser(app.reorderListHandler))
+	handle(http.MethodDelete, "/api/v1/lists/:id/movies/:movie_id", app.requireActivatedUser(app.removeListMovieHandler))
+	handle(http.MethodGet, "/api/v1/users/:id/lists", app.listUserListsHandler)
+
+	handle(http.MethodGet, "/api/v1/users/:id", app.requireUserCredentials(app.showCurrentUserHandler))
+	handle(http.MethodPatch, "/api/v1/users/:id", app.requireUserCredentials(app.updateCurrentUserHandler))
+	handle(http.MethodDelete, "/api/v1/users/:id", app.requireUserCredentials(app.deleteCurrentUserHandler))
+	handle(http.MethodPut, "/api/v1/users/password", app.updateUserPasswordHandler)
+	handle(http.MethodPut, "/api/v1/users/email", app.confirmEmailChangeHandler)
+
+	handle(http.MethodGet, "/api/v1/admin/users", app.requirePermission(data.PermissionUsersAdmin, app.listUsersHandler))
+	handle(http.MethodGet, "/api/v1/admin/users/:id", app.requirePermission(data.PermissionUsersAdmin, app.showUserHandler))
+	handle(http.MethodPatch, "/api/v1/admin/users/:id", app.requirePermission(data.PermissionUsersAdmin, app.updateUserHandler))
+	handle(http.MethodPost, "/api/v1/admin/users/:id/permissions", app.requirePermission(data.PermissionUsersAdmin, app.grantUserPermissionsHandler))
+	handle(http.MethodDelete, "/api/v1/admin/users/:id/permissions/:code", app.requirePermission(data.PermissionUsersAdmin, app.revokeUserPermissionHandler))
+
+	handle(http.MethodGet, "/api/v1/admin/limiter", app.requirePermission(data.PermissionLimiterAdmin, app.showLimiterHandler))
+	handle(http.MethodPatch, "/api/v1/admin/limiter", app.requirePermission(data.PermissionLimiterAdmin, app.updateLimiterHandler))
+
+	handle(http.MethodGet, "/api/v1/api-keys", app.requireActivatedUser(app.requireUserCredentials(app.listAPIKeysHandler)))
+	handle(http.MethodPost, "/api/v1/api-keys", app.requireActivatedUser(app.requireUserCredentials(app.createAPIKeyHandler)))
+	handle(http.MethodDelete, "/api/v1/api-keys/:id", app.requireActivatedUser(app.requireUserCredentials(app.deleteAPIKeyHandler)))
+
+	handle(http.MethodPost, "/api/v1/mfa/totp", app.requireActivatedUser(app.requireUserCredentials(app.enrollTOTPHandler)))
+	handle(http.MethodPost, "/api/v1/mfa/totp/confirm", app.requireActivatedUser(app.requireUserCredentials(app.confirmTOTPHandler)))
+	handle(http.MethodDelete, "/api/v1/mfa/totp", app.requireActivatedUser(app.requireUserCredentials(app.disableTOTPHandler)))
+
+	handle(http.MethodPost, "/api/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	handle(http.MethodPost, "/api/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	return app.requestID(app.accessLog(app.realIP(app.recoverPanic(app.denyListed(app.authenticate(app.rateLimiter(router)))))))
 }
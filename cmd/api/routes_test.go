@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/data"
+	"net/http"
+	"testing"
+)
+
+// TestCatalogWritesRequirePermission checks that every route changing
+// movies, people or credits is refused before its handler runs unless the
+// caller holds movies:write.
+func TestCatalogWritesRequirePermission(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/api/v1/movie", `{"title": "Casablanca"}`},
+		{http.MethodPut, "/api/v1/movie/1", `{"title": "Casablanca"}`},
+		{http.MethodPatch, "/api/v1/movie/1", `{"year": 1943}`},
+		{http.MethodDelete, "/api/v1/movie/1", ""},
+		{http.MethodPost, "/api/v1/movie/1/credits", `{"person_id": 1, "role": "actor"}`},
+		{http.MethodPatch, "/api/v1/credits/1", `{"character": "Rick"}`},
+		{http.MethodDelete, "/api/v1/credits/1", ""},
+		{http.MethodPost, "/api/v1/people", `{"name": "Ingrid Bergman"}`},
+		{http.MethodPatch, "/api/v1/people/1", `{"name": "Ingrid Bergman"}`},
+		{http.MethodDelete, "/api/v1/people/1", ""},
+	}
+
+	app := newTestApplication(t)
+
+	callers := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"without permission", app.bearer(t, 1), http.StatusForbidden},
+		{"with another permission", app.bearer(t, 1, data.PermissionUsersAdmin), http.StatusForbidden},
+	}
+
+	for _, route := range routes {
+		for _, caller := range callers {
+			t.Run(route.method+" "+route.path+"/"+caller.name, func(t *testing.T) {
+				w := app.do(route.method, route.path, caller.authorization, "application/json", route.body)
+				assertStatus(t, w, caller.want)
+			})
+		}
+	}
+}
@@ -5,41 +5,28 @@ import (
 	"errors"
 	"fmt"
 	"github.com/root-root1/rest/internal/jsonlog"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 func (app *Application) serve() error {
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
-
 	shutdown := make(chan error)
 
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", app.Config.Port),
 		Handler:           app.routes(),
 		IdleTimeout:       30 * time.Second,
-		ErrorLog:          log.New(logger, "", 0),
+		ErrorLog:          slog.NewLogLogger(app.Slog.Handler(), slog.LevelError),
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      5 * time.Second,
+		WriteTimeout:      app.Config.writeTimeout,
 	}
 
-	go func() {
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-
-		s := <-quit
-		app.Logger.PrintInfo("Caught Signal", map[string]string{
-			"signal": s.String(),
-		})
-
-		os.Exit(0)
-	}()
-
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -54,7 +41,50 @@ func (app *Application) serve() error {
 		shutdown <- srv.Shutdown(ctx)
 	}()
 
-	logger.PrintInfo("Starting server", map[string]string{
+	go func() {
+		for {
+			time.Sleep(time.Hour)
+			_, err := app.Models.Idempotency.DeleteExpired()
+			if err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+		}
+	}()
+
+	go app.reloadLimiterOnSIGHUP()
+
+	// Entries dropped by asynchronous outputs are reported every minute and
+	// once more on shutdown, so the last ones aren't lost with the process.
+	var reported atomic.Uint64
+	reportDropped := func() {
+		dropped := app.Logger.Dropped()
+		if previous := reported.Swap(dropped); dropped > previous {
+			app.Logger.Warn("log entries dropped", jsonlog.Int64("dropped", int64(dropped-previous)))
+		}
+	}
+
+	if app.Config.log.asyncBuffer > 0 {
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+				reportDropped()
+			}
+		}()
+	}
+
+	if app.Config.Limiter.store == "postgres" {
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+				_, err := app.Models.RateLimits.DeleteExpired()
+				if err != nil {
+					app.Logger.PrintError(err, nil)
+				}
+			}
+		}()
+	}
+
+	app.Logger.PrintInfo("Starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.Config.Env,
 	})
@@ -68,6 +98,10 @@ func (app *Application) serve() error {
 		return err
 	}
 
+	reportDropped()
+
+	// Returning rather than exiting lets main's deferred logger.Close flush
+	// the asynchronous outputs and finish any log file rotation.
 	app.Logger.PrintInfo("Stopping Server", map[string]string{
 		"addr": srv.Addr,
 	})
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/jsonlog"
+	"github.com/root-root1/rest/internal/jwt"
+	"github.com/root-root1/rest/internal/limiter"
+	"github.com/root-root1/rest/internal/realip"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApplication returns an application that authenticates with JWTs,
+// so requests carry their user and permissions and most routes can be
+// exercised against in-memory models without a database.
+func newTestApplication(t *testing.T) *Application {
+	t.Helper()
+
+	resolver, err := realip.New("", realip.HeaderXForwardedFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := jwt.NewHMACKey([]byte("test-signing-key-of-at-least-32-bytes"))
+
+	app := &Application{
+		Logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+		Models: data.NewMockModel(),
+
+		loginGuard:  newLoginGuard(5, 20, time.Minute, time.Hour),
+		jwtKey:      key,
+		jwtVerifier: jwt.NewVerifier("rest", "rest", time.Minute, key),
+		limiter:     limiter.NewTokenBucket(),
+		ipResolver:  resolver,
+	}
+
+	app.Config.auth.mode = "jwt"
+	app.Config.auth.issuer = "rest"
+	app.Config.auth.audience = "rest"
+	app.Config.auth.ttl = time.Minute
+
+	app.limits.Store(&limiterSettings{Policies: limiter.DefaultPolicies(limiter.Limit{Rate: 2, Burst: 4})})
+
+	return app
+}
+
+// bearer returns an Authorization header value for an activated user
+// holding permissions.
+func (app *Application) bearer(t *testing.T, userId int64, permissions ...string) string {
+	t.Helper()
+
+	now := time.Now()
+
+	token, err := jwt.Sign(app.jwtKey, jwt.Claims{
+		Subject:     strconv.FormatInt(userId, 10),
+		Issuer:      app.Config.auth.issuer,
+		Audience:    jwt.Audience{app.Config.auth.audience},
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(app.Config.auth.ttl).Unix(),
+		Activated:   true,
+		Permissions: permissions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + token
+}
+
+// do sends a request through the full middleware chain and router.
+func (app *Application) do(method string, path string, authorization string, contentType string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+
+	return w
+}
+
+// testMovieModel keeps movies in memory, unlike data.MockMovieModel whose
+// Get finds nothing and reports no error.
+type testMovieModel struct {
+	data.MockMovieModel
+	movies map[int64]*data.Movie
+}
+
+func (m testMovieModel) Get(id int64) (*data.Movie, error) {
+	movie, ok := m.movies[id]
+	if !ok {
+		return nil, data.ErrorRecordNotFound
+	}
+
+	copied := *movie
+	return &copied, nil
+}
+
+func (m testMovieModel) Update(movie *data.Movie) error {
+	if _, ok := m.movies[movie.Id]; !ok {
+		return data.ErrEditConflict
+	}
+
+	movie.Version++
+	m.movies[movie.Id] = movie
+	return nil
+}
+
+func (m testMovieModel) Delete(id int64) error {
+	if _, ok := m.movies[id]; !ok {
+		return data.ErrorRecordNotFound
+	}
+
+	delete(m.movies, id)
+	return nil
+}
+
+func newTestMovies() testMovieModel {
+	return testMovieModel{movies: map[int64]*data.Movie{
+		1: {Id: 1, Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama"}, Version: 1},
+	}}
+}
+
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if w.Code != want {
+		t.Fatalf("got status %d; want %d: %s", w.Code, want, w.Body.String())
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/jsonlog"
+	"github.com/root-root1/rest/internal/jwt"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *Application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ip := app.contextGetClientIP(r)
+
+	accountLock, ipLock := app.loginGuard.locked(input.Email, ip)
+	switch {
+	case ipLock > 0:
+		app.tooManyLoginAttemptsResponse(w, r, ipLock)
+		return
+	case accountLock > 0:
+		app.accountLockedResponse(w, r, accountLock)
+		return
+	}
+
+	user, err := app.models(r).Users.GetUserByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			data.MatchDummyPassword(input.Password)
+			app.failedLoginResponse(w, r, input.Email, 0, ip)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.failedLoginResponse(w, r, input.Email, user.Id, ip)
+		return
+	}
+
+	mfa, err := app.models(r).MFA.Get(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if mfa.Enabled {
+		if input.TOTPCode == "" && input.RecoveryCode == "" {
+			app.mfaRequiredResponse(w, r)
+			return
+		}
+
+		ok, err := app.verifySecondFactor(r, mfa, input.TOTPCode, input.RecoveryCode)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// A wrong code counts as a failed login so the lockout also
+		// covers guessing codes once the password is known.
+		if !ok {
+			app.failedLoginResponse(w, r, input.Email, user.Id, ip)
+			return
+		}
+	}
+
+	app.loginGuard.succeed(input.Email)
+
+	if user.Password.NeedsRehash() {
+		err = user.Password.Set(input.Password)
+		if err == nil {
+			err = app.models(r).Users.Update(user)
+		}
+
+		// The old hash still works, so a failed upgrade is retried on the
+		// next login rather than failing this one.
+		if err != nil {
+			app.LogError(r, err)
+		}
+	}
+
+	var token *data.Token
+
+	if app.Config.auth.mode == "jwt" {
+		token, err = app.newJWT(r, user)
+	} else {
+		token, err = app.models(r).Tokens.New(user.Id, 24*time.Hour, data.ScopeAuthentication)
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newJWT issues a signed token carrying everything the authenticate
+// middleware needs, so requests made with it don't touch the database.
+func (app *Application) newJWT(r *http.Request, user *data.User) (*data.Token, error) {
+	permissions, err := app.models(r).Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(app.Config.auth.ttl)
+
+	claims := jwt.Claims{
+		Subject:     strconv.FormatInt(user.Id, 10),
+		Issuer:      app.Config.auth.issuer,
+		Audience:    jwt.Audience{app.Config.auth.audience},
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   expiry.Unix(),
+		Activated:   user.Activation,
+		Permissions: permissions,
+	}
+
+	signed, err := jwt.Sign(app.jwtKey, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{PlainText: signed, UserId: user.Id, Expiry: expiry, Scope: data.ScopeAuthentication}, nil
+}
+
+// failedLoginResponse records a failed login against the account and the
+// client IP and responds with the lockout it triggered, if any. userId is
+// zero when no account has the email. Lockout events identify the account
+// by its id, since emails are redacted from the logs.
+func (app *Application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email string, userId int64, ip string) {
+	accountLock, ipLock := app.loginGuard.fail(email, ip)
+
+	logger := app.Logger.FromContext(r.Context()).With(jsonlog.String("ip", ip))
+	if userId != 0 {
+		logger = logger.With(jsonlog.Int64("user_id", userId))
+	}
+
+	if accountLock > 0 {
+		logger.Info("account locked",
+			jsonlog.String("event", "security.account_lockout"),
+			jsonlog.Duration("duration", accountLock),
+		)
+	}
+
+	if ipLock > 0 {
+		logger.Info("client ip locked",
+			jsonlog.String("event", "security.ip_lockout"),
+			jsonlog.Duration("duration", ipLock),
+		)
+	}
+
+	switch {
+	case ipLock > 0:
+		app.tooManyLoginAttemptsResponse(w, r, ipLock)
+	case accountLock > 0:
+		app.accountLockedResponse(w, r, accountLock)
+	default:
+		app.invalidCredentialsResponse(w, r)
+	}
+}
+
+func (app *Application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models(r).Users.GetUserByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrorRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The response is the same whether or not the email belongs to an
+	// account, so the endpoint can't be used to discover registered users.
+	if user != nil && user.Activation {
+		token, err := app.models(r).Tokens.New(user.Id, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			templateData := map[string]interface{}{
+				"name":               user.Name,
+				"passwordResetToken": token.PlainText,
+			}
+
+			err := app.Mailer.Send(user.Email, "password_reset.tmpl", templateData)
+			if err != nil {
+				app.LogError(r, err)
+			}
+		})
+	}
+
+	env := envelope{"message": "if the email belongs to an activated account you will receive password reset instructions"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
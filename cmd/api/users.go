@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/root-root1/rest/internal/data"
+	"github.com/root-root1/rest/internal/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (app *Application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models(r).Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models(r).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models(r).Tokens.DeleteAllScopesForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requestEmailChange stores email as the user's pending address and mails
+// it a token for confirmEmailChangeHandler. Earlier tokens stop working.
+func (app *Application) requestEmailChange(r *http.Request, user *data.User, email string) error {
+	err := app.models(r).Users.SetPendingEmail(user.Id, email)
+	if err != nil {
+		return err
+	}
+
+	err = app.models(r).Tokens.DeleteAllForUser(data.ScopeEmailChange, user.Id)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models(r).Tokens.New(user.Id, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		templateData := map[string]interface{}{
+			"name":             user.Name,
+			"emailChangeToken": token.PlainText,
+		}
+
+		err := app.Mailer.Send(email, "email_change.tmpl", templateData)
+		if err != nil {
+			app.LogError(r, err)
+		}
+	})
+
+	return nil
+}
+
+func (app *Application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models(r).Users.GetForToken(data.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models(r).Users.ConfirmPendingEmail(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateError):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrorRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models(r).Tokens.DeleteAllForUser(data.ScopeEmailChange, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your email address was successfully changed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCurrentUser serves /api/v1/users/:id routes that only exist for the
+// caller's own record. httprouter won't register a static "me" segment next
+// to the :id wildcard, so "me" is matched here instead.
+func (app *Application) readCurrentUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	if params.ByName("id") != "me" {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// JWT authentication only puts the id and activation state in the
+	// context, so the full record is always loaded here.
+	user, err := app.models(r).Users.Get(app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (app *Application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name            *string `json:"name"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	// A new email only replaces the current one once it has been confirmed
+	// with a token mailed to it, so the account stays usable meanwhile.
+	pendingEmail := ""
+	if input.Email != nil && *input.Email != user.Email {
+		pendingEmail = *input.Email
+		data.ValidateEmail(v, pendingEmail)
+	}
+
+	if input.Password != nil {
+		if input.CurrentPassword == nil {
+			v.AddError("current_password", "must be provided to change the password")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		match, err := user.Password.Matches(*input.CurrentPassword)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !match {
+			v.AddError("current_password", "is incorrect")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if pendingEmail != "" {
+		_, err := app.models(r).Users.GetUserByEmail(pendingEmail)
+		switch {
+		case err == nil:
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, data.ErrorRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models(r).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateError):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A new password signs out every other session and revokes the API
+	// keys, which whoever knew the old password may have created. JWTs
+	// can't be revoked and stay valid until they expire.
+	if input.Password != nil {
+		current := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		err = app.models(r).Tokens.DeleteAllForUserExcept(data.ScopeAuthentication, user.Id, current)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.models(r).APIKeys.DeleteAllForUser(user.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"user": user}
+
+	if pendingEmail != "" {
+		err = app.requestEmailChange(r, user, pendingEmail)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["message"] = "a confirmation token was sent to the new email address, which takes effect once confirmed"
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword *string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.CurrentPassword == nil {
+		v.AddError("current_password", "must be provided to delete the account")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(*input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models(r).Users.Delete(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrorRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,14 +1,13 @@
 module github.com/root-root1/rest
 
-go 1.19
+go 1.21
 
 require (
 	github.com/joho/godotenv v1.4.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.2
+	golang.org/x/crypto v0.5.0
+	golang.org/x/time v0.3.0
 )
 
-require (
-	golang.org/x/crypto v0.5.0 // indirect
-	golang.org/x/time v0.3.0 // indirect
-)
+require golang.org/x/sys v0.4.0 // indirect
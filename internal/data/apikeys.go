@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/root-root1/rest/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var APIKeyRX = regexp.MustCompile("^rk_([a-z2-7]{8})_[a-z2-7]{32}$")
+
+type APIKey struct {
+	Id         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserId     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	PlainText  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+
+	if key.ExpiresAt != nil {
+		v.Check(key.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(validator.Match(plaintext, APIKeyRX), "key", "must be a valid API key")
+}
+
+// generateAPIKey creates a key of the form rk_<prefix>_<secret>. The prefix
+// is stored in clear so users can tell their keys apart; only the hash of
+// the whole key is kept.
+func generateAPIKey() (plaintext string, prefix string, err error) {
+	randomBytes := make([]byte, 25)
+
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+
+	prefix = encoded[:8]
+	plaintext = "rk_" + prefix + "_" + encoded[8:40]
+
+	return plaintext, prefix, nil
+}
+
+type APIKeyModel struct {
+	DB *DB
+}
+
+func (m APIKeyModel) New(key *APIKey) error {
+	plaintext, prefix, err := generateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	key.PlainText = plaintext
+	key.Prefix = prefix
+	key.Hash = hash[:]
+
+	query := `
+		insert into api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at
+	`
+
+	args := []interface{}{key.UserId, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes), key.ExpiresAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.Id, &key.CreatedAt)
+}
+
+func (m APIKeyModel) GetAllForUser(userId int64) ([]*APIKey, error) {
+	query := `
+		select id, created_at, user_id, name, prefix, scopes, expires_at, last_used_at
+		from api_keys
+		where user_id = $1
+		order by id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.Id,
+			&key.CreatedAt,
+			&key.UserId,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey returns an unexpired key and its owner, and records that the key
+// was used.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, *User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		select k.id, k.created_at, k.user_id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at,
+		       u.id, u.created_at, u.name, u.email, u.password_hash, u.activation, u.version
+		from api_keys k
+		inner join users u on u.id = k.user_id
+		where k.key_hash = $1 and (k.expires_at is null or k.expires_at > now())
+	`
+
+	var key APIKey
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.Id,
+		&key.CreatedAt,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&user.Id,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activation,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrorRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	// last_used_at is only precise to the minute so a busy key doesn't
+	// rewrite its row on every request.
+	_, err = m.DB.ExecContext(ctx, `
+		update api_keys set last_used_at = now()
+		where id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute')
+	`, key.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &key, &user, nil
+}
+
+func (m APIKeyModel) Delete(id int64, userId int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from api_keys
+		where id = $1 and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func (m APIKeyModel) DeleteAllForUser(userId int64) error {
+	query := `
+		delete from api_keys
+		where user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userId)
+	return err
+}
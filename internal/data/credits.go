@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/root-root1/rest/internal/validator"
+	"time"
+)
+
+var CreditRoles = []string{"director", "actor", "writer"}
+
+type Credit struct {
+	Id           int64  `json:"id"`
+	MovieId      int64  `json:"movie_id"`
+	PersonId     int64  `json:"person_id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonId > 0, "person_id", "must be provided")
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of director, actor or writer")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+	v.Check(credit.BillingOrder <= 10_000, "billing_order", "must not be greater than 10000")
+}
+
+type CreditModel struct {
+	DB *DB
+}
+
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+		with inserted as (
+			insert into movie_credits (movie_id, person_id, role, billing_order)
+			values ($1, $2, $3, $4)
+			returning id, person_id
+		)
+		select inserted.id, people.name
+		from inserted
+		inner join people on people.id = inserted.person_id
+	`
+
+	args := []interface{}{credit.MovieId, credit.PersonId, credit.Role, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.Id, &credit.Name)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_movie_person_role_key"`:
+			return ErrDuplicateError
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CreditModel) Get(id int64) (*Credit, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+		select c.id, c.movie_id, c.person_id, p.name, c.role, c.billing_order
+		from movie_credits c
+		inner join people p on p.id = c.person_id
+		where c.id = $1
+	`
+
+	var credit Credit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&credit.Id,
+		&credit.MovieId,
+		&credit.PersonId,
+		&credit.Name,
+		&credit.Role,
+		&credit.BillingOrder,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &credit, nil
+}
+
+func (m CreditModel) Update(credit *Credit) error {
+	query := `
+		update movie_credits
+		set role = $1, billing_order = $2
+		where id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, credit.Role, credit.BillingOrder, credit.Id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_movie_person_role_key"`:
+			return ErrDuplicateError
+		default:
+			return err
+		}
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func (m CreditModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from movie_credits
+		where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// GetForMovies returns the credits of every given movie keyed by movie id,
+// ordered by role and billing order.
+func (m CreditModel) GetForMovies(movieIds []int64) (map[int64][]*Credit, error) {
+	query := `
+		select c.id, c.movie_id, c.person_id, p.name, c.role, c.billing_order
+		from movie_credits c
+		inner join people p on p.id = c.person_id
+		where c.movie_id = any($1)
+		order by c.movie_id, c.role, c.billing_order, c.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIds))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(movieIds))
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.Id,
+			&credit.MovieId,
+			&credit.PersonId,
+			&credit.Name,
+			&credit.Role,
+			&credit.BillingOrder,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+		credits[credit.MovieId] = append(credits[credit.MovieId], &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
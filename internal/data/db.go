@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// DB is the connection pool the models query through. A DB bound to a
+// request prefixes every statement with a comment carrying the request id,
+// so slow or failing queries seen in pg_stat_activity or the Postgres logs
+// can be matched with the request that sent them.
+type DB struct {
+	*sql.DB
+	comment string
+}
+
+func NewDB(db *sql.DB) *DB {
+	return &DB{DB: db}
+}
+
+func (db *DB) WithRequestID(id string) *DB {
+	// The id ends up inside a SQL comment, so anything that could close it
+	// is dropped.
+	id = strings.NewReplacer("*", "", "/", "").Replace(id)
+
+	return &DB{DB: db.DB, comment: "/* request_id=" + id + " */ "}
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.comment+query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.comment+query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.comment+query, args...)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, comment: db.comment}, nil
+}
+
+type Tx struct {
+	*sql.Tx
+	comment string
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.comment+query, args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.comment+query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.comment+query, args...)
+}
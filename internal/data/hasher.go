@@ -0,0 +1,181 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+var ErrUnsupportedHash = errors.New("Unsupported Password Hash")
+
+// PasswordHasher produces password hashes for new passwords. Verification
+// goes through verifyPassword instead, so hashes made by any supported
+// algorithm keep working after the primary hasher changes.
+type PasswordHasher interface {
+	Hash(plaintext string) ([]byte, error)
+	NeedsRehash(hash []byte) bool
+}
+
+var passwordHasher PasswordHasher = BcryptHasher{Cost: 12}
+
+// SetPasswordHasher replaces the hasher used by password.Set. It is meant to
+// be called once at startup.
+func SetPasswordHasher(h PasswordHasher) {
+	passwordHasher = h
+	dummyHashOnce = sync.Once{}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// MatchDummyPassword checks plaintext against a throwaway hash made by the
+// configured PasswordHasher and discards the result. Logins for unknown
+// emails call it so that they take as long as those with a wrong password
+// and can't be timed to find out which emails have accounts.
+func MatchDummyPassword(plaintext string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = passwordHasher.Hash("not the password of any account")
+	})
+
+	verifyPassword(dummyHash, plaintext)
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(plaintext string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plaintext), h.Cost)
+}
+
+func (h BcryptHasher) NeedsRehash(hash []byte) bool {
+	if !isBcryptHash(hash) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true
+	}
+
+	return cost < h.Cost
+}
+
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h Argon2idHasher) Hash(plaintext string) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash []byte) bool {
+	params, _, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory < h.Memory ||
+		params.Iterations < h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(key)) != h.KeyLength
+}
+
+func decodeArgon2id(hash []byte) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func isBcryptHash(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$2a$") ||
+		strings.HasPrefix(string(hash), "$2b$") ||
+		strings.HasPrefix(string(hash), "$2y$")
+}
+
+func verifyPassword(hash []byte, plaintext string) (bool, error) {
+	switch {
+	case isBcryptHash(hash):
+		err := bcrypt.CompareHashAndPassword(hash, []byte(plaintext))
+		if err != nil {
+			switch {
+			case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+		return true, nil
+
+	case strings.HasPrefix(string(hash), "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(plaintext), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
@@ -0,0 +1,24 @@
+package data
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestMatchDummyPasswordUsesConfiguredHasher(t *testing.T) {
+	defer SetPasswordHasher(passwordHasher)
+
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 1} {
+		SetPasswordHasher(BcryptHasher{Cost: cost})
+
+		MatchDummyPassword("pa55word")
+
+		got, err := bcrypt.Cost(dummyHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != cost {
+			t.Errorf("got dummy hash cost %d; want %d", got, cost)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint []byte
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LockedAt    time.Time
+}
+
+type IdempotencyModel struct {
+	DB *DB
+}
+
+// Reserve claims the key for a new request. It returns false when a live
+// record already exists for the key. Expired records are taken over, and so
+// are reservations that were never completed and have been locked for longer
+// than lockTimeout, which happens when the process dies mid-request.
+// lockTimeout must be longer than any request may take, or a slow request
+// and its retry could both run.
+func (m IdempotencyModel) Reserve(record *IdempotencyRecord, lockTimeout time.Duration) (bool, error) {
+	query := `
+		insert into idempotency_keys (scope, key, method, path, fingerprint, expires_at)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (scope, key, method, path) do update
+		set fingerprint = excluded.fingerprint, status = null, header = null, body = null,
+		    created_at = now(), expires_at = excluded.expires_at, locked_at = now()
+		where idempotency_keys.expires_at < now()
+		   or (idempotency_keys.status is null and idempotency_keys.locked_at < now() - make_interval(secs => $7))
+		returning created_at, locked_at
+	`
+
+	args := []interface{}{record.Scope, record.Key, record.Method, record.Path, record.Fingerprint, record.ExpiresAt, lockTimeout.Seconds()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&record.CreatedAt, &record.LockedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (m IdempotencyModel) Get(scope string, key string, method string, path string) (*IdempotencyRecord, error) {
+	query := `
+		select scope, key, method, path, fingerprint, coalesce(status, 0), header, body, created_at, expires_at, locked_at
+		from idempotency_keys
+		where scope = $1 and key = $2 and method = $3 and path = $4 and expires_at > now()
+	`
+
+	var record IdempotencyRecord
+	var header []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, scope, key, method, path).Scan(
+		&record.Scope,
+		&record.Key,
+		&record.Method,
+		&record.Path,
+		&record.Fingerprint,
+		&record.Status,
+		&header,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+		&record.LockedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if header != nil {
+		err = json.Unmarshal(header, &record.Header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// Complete stores the response for replay. It does nothing when another
+// request has since taken the reservation over.
+func (m IdempotencyModel) Complete(record *IdempotencyRecord) error {
+	query := `
+		update idempotency_keys
+		set status = $1, header = $2, body = $3
+		where scope = $4 and key = $5 and method = $6 and path = $7 and locked_at = $8
+	`
+
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{record.Status, header, record.Body, record.Scope, record.Key, record.Method, record.Path, record.LockedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Delete releases a reservation that was not completed. Like Complete, it
+// leaves the record alone once another request has taken it over.
+func (m IdempotencyModel) Delete(record *IdempotencyRecord) error {
+	query := `
+		delete from idempotency_keys
+		where scope = $1 and key = $2 and method = $3 and path = $4 and locked_at = $5
+	`
+
+	args := []interface{}{record.Scope, record.Key, record.Method, record.Path, record.LockedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+		delete from idempotency_keys
+		where expires_at < now()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
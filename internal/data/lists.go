@@ -0,0 +1,335 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/root-root1/rest/internal/validator"
+	"time"
+)
+
+type List struct {
+	Id        int64        `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserId    int64        `json:"user_id"`
+	Name      string       `json:"name"`
+	Public    bool         `json:"public"`
+	Version   int32        `json:"version"`
+	Entries   []*ListEntry `json:"movies,omitempty"`
+}
+
+type ListEntry struct {
+	MovieId  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year,omitempty"`
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+type ListModel struct {
+	DB *DB
+}
+
+func (m ListModel) Insert(list *List) error {
+	query := `
+		insert into lists (user_id, name, public)
+		values ($1, $2, $3)
+		returning id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, list.UserId, list.Name, list.Public).Scan(&list.Id, &list.CreatedAt, &list.Version)
+}
+
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+		select id, created_at, user_id, name, public, version
+		from lists
+		where id = $1
+	`
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.Id,
+		&list.CreatedAt,
+		&list.UserId,
+		&list.Name,
+		&list.Public,
+		&list.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+func (m ListModel) Update(list *List) error {
+	query := `
+		update lists
+		set name = $1, public = $2, version = version + 1
+		where id = $3 and version = $4
+		returning version
+	`
+
+	args := []interface{}{list.Name, list.Public, list.Id, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from lists
+		where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns the lists owned by a user. Private lists are only
+// included when includePrivate is set, i.e. when the owner is asking.
+func (m ListModel) GetAllForUser(userId int64, includePrivate bool, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, user_id, name, public, version
+		from lists
+		where user_id = $1 and (public or $2)
+		order by %s %s, id asc
+		limit $3 offset $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, includePrivate, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecord := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecord,
+			&list.Id,
+			&list.CreatedAt,
+			&list.UserId,
+			&list.Name,
+			&list.Public,
+			&list.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecord, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+func (m ListModel) GetEntries(listId int64) ([]*ListEntry, error) {
+	query := `
+		select lm.movie_id, movies.title, movies.year, lm.position, lm.added_at
+		from list_movies lm
+		inner join movies on movies.id = lm.movie_id
+		where lm.list_id = $1
+		order by lm.position, lm.added_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*ListEntry{}
+
+	for rows.Next() {
+		var entry ListEntry
+
+		err := rows.Scan(
+			&entry.MovieId,
+			&entry.Title,
+			&entry.Year,
+			&entry.Position,
+			&entry.AddedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// AddMovie appends a movie to the end of a list.
+func (m ListModel) AddMovie(listId int64, movieId int64) error {
+	query := `
+		insert into list_movies (list_id, movie_id, position)
+		select $1, $2, coalesce(max(position), 0) + 1
+		from list_movies
+		where list_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, listId, movieId)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "list_movies_pkey"`:
+			return ErrDuplicateError
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) RemoveMovie(listId int64, movieId int64) error {
+	query := `
+		delete from list_movies
+		where list_id = $1 and movie_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listId, movieId)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// Reorder sets the position of every entry to its index in movieIds. It
+// returns ErrEditConflict when movieIds doesn't name exactly the movies
+// currently on the list.
+func (m ListModel) Reorder(listId int64, movieIds []int64) error {
+	query := `
+		update list_movies
+		set position = o.position
+		from unnest($2::bigint[]) with ordinality as o(movie_id, position)
+		where list_movies.list_id = $1 and list_movies.movie_id = o.movie_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var total int
+	err = tx.QueryRowContext(ctx, `select count(*) from list_movies where list_id = $1`, listId).Scan(&total)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, listId, pq.Array(movieIds))
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if int(affectedRow) != total || total != len(movieIds) {
+		return ErrEditConflict
+	}
+
+	return tx.Commit()
+}
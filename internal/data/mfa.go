@@ -0,0 +1,226 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type MFA struct {
+	UserId      int64
+	Secret      []byte
+	Enabled     bool
+	LastCounter int64
+}
+
+// GenerateRecoveryCodes returns one-time codes formatted as xxxxx-xxxxx
+// along with the hashes that get stored.
+func GenerateRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+		codes[i] = encoded[:5] + "-" + encoded[5:10]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
+
+type MFAModel struct {
+	DB *DB
+}
+
+func (m MFAModel) Get(userId int64) (*MFA, error) {
+	query := `
+		select id, mfa_secret, mfa_enabled, mfa_last_counter
+		from users
+		where id = $1
+	`
+
+	var mfa MFA
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(&mfa.UserId, &mfa.Secret, &mfa.Enabled, &mfa.LastCounter)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &mfa, nil
+}
+
+// SetPendingSecret stores a secret that is not enforced until Enable is
+// called with a code generated from it.
+func (m MFAModel) SetPendingSecret(userId int64, secret []byte) error {
+	query := `
+		update users
+		set mfa_secret = $1, mfa_last_counter = 0
+		where id = $2 and not mfa_enabled
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, secret, userId)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (m MFAModel) Enable(userId int64, counter int64, recoveryHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		update users
+		set mfa_enabled = true, mfa_last_counter = $1
+		where id = $2 and not mfa_enabled and mfa_secret is not null
+	`, counter, userId)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.ExecContext(ctx, `insert into mfa_recovery_codes (user_id, code_hash) values ($1, $2)`, userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseCounter records a TOTP time step as used. It reports false when that
+// step or a later one was already accepted, so a code can't be replayed.
+func (m MFAModel) UseCounter(userId int64, counter int64) (bool, error) {
+	query := `
+		update users
+		set mfa_last_counter = $1
+		where id = $2 and mfa_last_counter < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, counter, userId)
+	if err != nil {
+		return false, err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRow == 1, nil
+}
+
+// UseRecoveryCode consumes a recovery code. It reports false when the code
+// doesn't exist or was already used.
+func (m MFAModel) UseRecoveryCode(userId int64, code string) (bool, error) {
+	query := `
+		update mfa_recovery_codes
+		set used_at = now()
+		where user_id = $1 and code_hash = $2 and used_at is null
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affectedRow == 1, nil
+}
+
+func (m MFAModel) Disable(userId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update users
+		set mfa_secret = null, mfa_enabled = false, mfa_last_counter = 0
+		where id = $1
+	`, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
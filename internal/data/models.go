@@ -13,21 +13,71 @@ var (
 type Models struct {
 	Movies interface {
 		Insert(movie *Movie) error
+		InsertWithId(movie *Movie) error
 		Get(id int64) (*Movie, error)
+		GetMany(ids []int64) ([]*Movie, error)
 		Update(movie *Movie) error
 		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		GetAll(title string, genres []string, personId int64, filters Filters) ([]*Movie, Metadata, error)
 	}
-	Users UserModel
+	Users       UserModel
+	Idempotency IdempotencyModel
+	People      PersonModel
+	Credits     CreditModel
+	Tokens      TokenModel
+	Reviews     ReviewModel
+	Lists       ListModel
+	Permissions interface {
+		GetAll() (Permissions, error)
+		GetAllForUser(userId int64) (Permissions, error)
+		AddForUser(userId int64, codes ...string) error
+		RemoveForUser(userId int64, codes ...string) error
+	}
+	APIKeys interface {
+		New(key *APIKey) error
+		GetAllForUser(userId int64) ([]*APIKey, error)
+		GetForKey(plaintext string) (*APIKey, *User, error)
+		Delete(id int64, userId int64) error
+		DeleteAllForUser(userId int64) error
+	}
+	MFA        MFAModel
+	RateLimits RateLimitModel
+
+	db *DB
 }
 
 func NewModel(db *sql.DB) Models {
+	return newModels(NewDB(db))
+}
+
+func newModels(db *DB) Models {
 	return Models{
-		Movies: MovieModel{db: db},
-		Users:  UserModel{DB: db},
+		Movies:      MovieModel{db: db},
+		Users:       UserModel{DB: db},
+		Idempotency: IdempotencyModel{DB: db},
+		People:      PersonModel{DB: db},
+		Credits:     CreditModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		Reviews:     ReviewModel{DB: db},
+		Lists:       ListModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+		APIKeys:     APIKeyModel{DB: db},
+		MFA:         MFAModel{DB: db},
+		RateLimits:  RateLimitModel{DB: db},
+
+		db: db,
 	}
 }
 
+// WithRequestID returns models whose queries are tagged with the request id.
+func (m Models) WithRequestID(id string) Models {
+	if m.db == nil {
+		return m
+	}
+
+	return newModels(m.db.WithRequestID(id))
+}
+
 func NewMockModel() Models {
 	return Models{
 		Movies: MockMovieModel{},
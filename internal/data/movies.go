@@ -11,13 +11,16 @@ import (
 )
 
 type Movie struct {
-	Id        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	Id            int64     `json:"id"`
+	CreatedAt     time.Time `json:"-"`
+	Title         string    `json:"title"`
+	Year          int32     `json:"year,omitempty"`
+	Runtime       Runtime   `json:"runtime,omitempty"`
+	Genres        []string  `json:"genres,omitempty"`
+	Version       int32     `json:"version"`
+	AverageRating float64   `json:"average_rating"`
+	RatingCount   int64     `json:"rating_count"`
+	Credits       []*Credit `json:"credits,omitempty"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -35,7 +38,7 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 }
 
 type MovieModel struct {
-	db *sql.DB
+	db *DB
 }
 
 func (m MovieModel) Insert(movie *Movie) error {
@@ -53,13 +56,58 @@ func (m MovieModel) Insert(movie *Movie) error {
 	return m.db.QueryRowContext(ctx, query, args...).Scan(&movie.Id, &movie.CreatedAt, &movie.Version)
 }
 
+// InsertWithId creates a movie with a caller-chosen id and moves the id
+// sequence past it so later inserts don't collide. The sequence only ever
+// moves forward, so ids freed by deletes are not handed out again.
+func (m MovieModel) InsertWithId(movie *Movie) error {
+	query := `
+		insert into movies (id, title, year, runtime, genres)
+		values ($1, $2, $3, $4, $5)
+		on conflict (id) do nothing
+		returning created_at, version`
+
+	args := []interface{}{movie.Id, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.CreatedAt, &movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `select setval('movies_id_seq', greatest($1, (select last_value from movies_id_seq)))`, movie.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (m MovieModel) Get(id int64) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrorRecordNotFound
 	}
 	query := `
-		select id, created_at, title, year, runtime, genres, version
+		select id, created_at, title, year, runtime, genres, version,
+		       coalesce(ratings.avg_score, 0), ratings.score_count
 		from movies
+		left join lateral (
+			select round(avg(score), 2)::float8 as avg_score, count(*) as score_count
+			from reviews
+			where reviews.movie_id = movies.id
+		) ratings on true
 		where id=$1
 	`
 	var movie Movie
@@ -76,6 +124,8 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
 	)
 
 	if err != nil {
@@ -90,6 +140,68 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
+// GetMany fetches the movies with the given ids in a single query. The result
+// follows the order of ids and leaves out the ids that don't exist.
+func (m MovieModel) GetMany(ids []int64) ([]*Movie, error) {
+	query := `
+		select id, created_at, title, year, runtime, genres, version,
+		       coalesce(ratings.avg_score, 0), ratings.score_count
+		from movies
+		left join lateral (
+			select round(avg(score), 2)::float8 as avg_score, count(*) as score_count
+			from reviews
+			where reviews.movie_id = movies.id
+		) ratings on true
+		where id = any($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	found := make(map[int64]*Movie, len(ids))
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.Id,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+		found[movie.Id] = &movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	movies := make([]*Movie, 0, len(found))
+	for _, id := range ids {
+		if movie, ok := found[id]; ok {
+			movies = append(movies, movie)
+		}
+	}
+
+	return movies, nil
+}
+
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
 		update movies
@@ -155,20 +267,27 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MovieModel) GetAll(title string, genres []string, personId int64, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-		select count(*) over(), id, created_at, title, year, runtime, genres, version
+		select count(*) over(), id, created_at, title, year, runtime, genres, version,
+		       coalesce(ratings.avg_score, 0) as average_rating, ratings.score_count as rating_count
 		from movies
+		left join lateral (
+			select round(avg(score), 2)::float8 as avg_score, count(*) as score_count
+			from reviews
+			where reviews.movie_id = movies.id
+		) ratings on true
 		where ((to_tsvector('english', title) @@ plainto_tsquery('english', $1)) or $1 = '')
 		and (genres @> $2 or $2 = '{}')
+		and ($3 = 0 or exists (select 1 from movie_credits c where c.movie_id = movies.id and c.person_id = $3))
 		order by %s %s, id asc
-		limit $3 offset $4
+		limit $4 offset $5
     `, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args := []interface{}{title, pq.Array(genres), personId, filters.limit(), filters.offset()}
 
 	rows, err := m.db.QueryContext(ctx, query, args...)
 
@@ -194,6 +313,8 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
 		)
 
 		if err != nil {
@@ -220,10 +341,18 @@ func (m MockMovieModel) Insert(movie *Movie) error {
 	return nil
 }
 
+func (m MockMovieModel) InsertWithId(movie *Movie) error {
+	return nil
+}
+
 func (m MockMovieModel) Get(id int64) (*Movie, error) {
 	return nil, nil
 }
 
+func (m MockMovieModel) GetMany(ids []int64) ([]*Movie, error) {
+	return nil, nil
+}
+
 func (m MockMovieModel) Update(movie *Movie) error {
 	return nil
 }
@@ -232,6 +361,6 @@ func (m MockMovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MockMovieModel) GetAll(title string, genres []string, personId int64, filters Filters) ([]*Movie, Metadata, error) {
 	return nil, Metadata{}, nil
 }
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/root-root1/rest/internal/validator"
+	"time"
+)
+
+type Person struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	if person.BirthYear != 0 {
+		v.Check(person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+}
+
+type PersonModel struct {
+	DB *DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+	query := `
+		insert into people (name, birth_year)
+		values ($1, nullif($2, 0))
+		returning id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, person.Name, person.BirthYear).Scan(&person.Id, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+		select id, created_at, name, coalesce(birth_year, 0), version
+		from people
+		where id = $1
+	`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.Id,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) Update(person *Person) error {
+	query := `
+		update people
+		set name = $1, birth_year = nullif($2, 0), version = version + 1
+		where id = $3 and version = $4
+		returning version
+	`
+
+	args := []interface{}{person.Name, person.BirthYear, person.Id, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from people
+		where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func (m PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, name, coalesce(birth_year, 0), version
+		from people
+		where (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) or $1 = '')
+		order by %s %s, id asc
+		limit $2 offset $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecord := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+
+		err := rows.Scan(
+			&totalRecord,
+			&person.Id,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecord, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	PermissionMoviesWrite  = "movies:write"
+	PermissionUsersAdmin   = "users:admin"
+	PermissionLimiterAdmin = "limiter:admin"
+)
+
+type Permissions []string
+
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns the permissions held by both p and other, such as the
+// scopes of an API key that its owner still holds.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	both := Permissions{}
+	for _, code := range p {
+		if other.Include(code) {
+			both = append(both, code)
+		}
+	}
+	return both
+}
+
+type PermissionModel struct {
+	DB *DB
+}
+
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		select code
+		from permissions
+		order by code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (m PermissionModel) GetAllForUser(userId int64) (Permissions, error) {
+	query := `
+		select permissions.code
+		from permissions
+		inner join users_permissions on users_permissions.permission_id = permissions.id
+		where users_permissions.user_id = $1
+		order by permissions.code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (m PermissionModel) AddForUser(userId int64, codes ...string) error {
+	query := `
+		insert into users_permissions (user_id, permission_id)
+		select $1, permissions.id from permissions where permissions.code = any($2)
+		on conflict do nothing
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userId, pq.Array(codes))
+	return err
+}
+
+func (m PermissionModel) RemoveForUser(userId int64, codes ...string) error {
+	query := `
+		delete from users_permissions
+		using permissions
+		where users_permissions.permission_id = permissions.id
+		and users_permissions.user_id = $1 and permissions.code = any($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
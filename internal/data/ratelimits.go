@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitModel stores the fixed window counters of the sliding window
+// rate limiter so that every replica sees the same counts.
+type RateLimitModel struct {
+	DB *DB
+}
+
+// Add implements limiter.Store. window_start holds the unix time in
+// nanoseconds each window starts at.
+func (m RateLimitModel) Add(key string, start int64, length time.Duration, delta int64, expiry time.Time) (int64, int64, error) {
+	query := `
+		with upsert as (
+			insert into rate_limits (key, window_start, count, expires_at)
+			values ($1, $2, $3, $4)
+			on conflict (key, window_start) do update
+			set count = rate_limits.count + excluded.count,
+			    expires_at = greatest(rate_limits.expires_at, excluded.expires_at)
+			returning count
+		)
+		select upsert.count + coalesce((
+				select sum(count) from rate_limits
+				where key = $1 and window_start > $2
+			), 0)::bigint,
+			coalesce((
+				select sum(count) from rate_limits
+				where key = $1 and window_start >= $2 - $5::bigint and window_start < $2
+			), 0)::bigint
+		from upsert
+	`
+
+	var current, previous int64
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key, start, delta, expiry, int64(length)).Scan(&current, &previous)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return current, previous, nil
+}
+
+func (m RateLimitModel) DeleteExpired() (int64, error) {
+	query := `
+		delete from rate_limits
+		where expires_at < now()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/root-root1/rest/internal/validator"
+	"time"
+)
+
+type Review struct {
+	Id        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserId    int64     `json:"user_id"`
+	MovieId   int64     `json:"movie_id"`
+	Score     int32     `json:"score"`
+	Body      string    `json:"body,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Score >= 1, "score", "must be at least 1")
+	v.Check(review.Score <= 10, "score", "must not be more than 10")
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *DB
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+		insert into reviews (user_id, movie_id, score, body)
+		values ($1, $2, $3, $4)
+		returning id, created_at, version
+	`
+
+	args := []interface{}{review.UserId, review.MovieId, review.Score, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.Id, &review.CreatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_user_movie_key"`:
+			return ErrDuplicateError
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Get(id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+		select id, created_at, user_id, movie_id, score, body, version
+		from reviews
+		where id = $1
+	`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&review.Id,
+		&review.CreatedAt,
+		&review.UserId,
+		&review.MovieId,
+		&review.Score,
+		&review.Body,
+		&review.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+		update reviews
+		set score = $1, body = $2, version = version + 1
+		where id = $3 and version = $4
+		returning version
+	`
+
+	args := []interface{}{review.Score, review.Body, review.Id, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from reviews
+		where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func (m ReviewModel) GetForMovie(movieId int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, user_id, movie_id, score, body, version
+		from reviews
+		where movie_id = $1
+		order by %s %s, id asc
+		limit $2 offset $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecord := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecord,
+			&review.Id,
+			&review.CreatedAt,
+			&review.UserId,
+			&review.MovieId,
+			&review.Score,
+			&review.Body,
+			&review.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecord, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
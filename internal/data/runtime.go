@@ -27,7 +27,7 @@ func (r *Runtime) UnmarshalJSON(jsonvalue []byte) error {
 
 	part := strings.Split(unquotedJSONValue, " ")
 
-	if len(part) != 2 || part[1] != "mins" {
+	if len(part) != 2 || (part[1] != "mins" && part[1] != "min") {
 		return InvalidRuntimeJsonFormat
 	}
 
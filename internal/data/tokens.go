@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"github.com/root-root1/rest/internal/validator"
+	"time"
+)
+
+const (
+	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
+)
+
+type Token struct {
+	PlainText string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserId    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserId: userId,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.PlainText = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.PlainText))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+type TokenModel struct {
+	DB *DB
+}
+
+func (m TokenModel) New(userId int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userId, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m TokenModel) Insert(token *Token) error {
+	query := `
+		insert into tokens (hash, user_id, expiry, scope)
+		values ($1, $2, $3, $4)
+	`
+
+	args := []interface{}{token.Hash, token.UserId, token.Expiry, token.Scope}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m TokenModel) DeleteAllForUser(scope string, userId int64) error {
+	query := `
+		delete from tokens
+		where scope = $1 and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userId)
+	return err
+}
+
+// DeleteAllForUserExcept deletes the user's tokens with scope other than the
+// one given in plaintext, which is typically the token of the request itself.
+func (m TokenModel) DeleteAllForUserExcept(scope string, userId int64, plaintext string) error {
+	query := `
+		delete from tokens
+		where scope = $1 and user_id = $2 and hash <> $3
+	`
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userId, hash[:])
+	return err
+}
+
+func (m TokenModel) DeleteAllScopesForUser(userId int64) error {
+	query := `
+		delete from tokens
+		where user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userId)
+	return err
+}
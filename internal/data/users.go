@@ -2,10 +2,11 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/root-root1/rest/internal/validator"
-	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
@@ -19,6 +20,12 @@ type User struct {
 	Version    int       `json:"-"`
 }
 
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
 type password struct {
 	PlainText *string
 	hash      []byte
@@ -29,11 +36,11 @@ var (
 )
 
 type UserModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
 func (p *password) Set(plaintext string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 12)
+	hash, err := passwordHasher.Hash(plaintext)
 
 	if err != nil {
 		return err
@@ -45,21 +52,16 @@ func (p *password) Set(plaintext string) error {
 }
 
 func (p *password) Matches(plaintextpassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextpassword))
-
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
-	}
+	return verifyPassword(p.hash, plaintextpassword)
+}
 
-	return true, nil
+// NeedsRehash reports whether the stored hash was made with a different
+// algorithm or weaker parameters than the configured PasswordHasher.
+func (p *password) NeedsRehash() bool {
+	return passwordHasher.NeedsRehash(p.hash)
 }
 
-func validate(v *validator.Validator, email string) {
+func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "email must provided")
 	v.Check(validator.Match(email, validator.EmailRX), "email", "must be a valid email")
 }
@@ -74,13 +76,13 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "user", "must be provided")
 	v.Check(len(user.Name) <= 500, "user", "must not be greater (72 character) long")
 
-	validate(v, user.Email)
+	ValidateEmail(v, user.Email)
 
 	if user.Password.PlainText != nil {
 		ValidatePasswordPlaintext(v, *user.Password.PlainText)
 	}
 
-	if user.Password.hash != nil {
+	if user.Password.hash == nil {
 		panic("missing password user for hash")
 	}
 }
@@ -180,3 +182,223 @@ func (m UserModel) Update(user *User) error {
 	}
 	return nil
 }
+
+// SetPendingEmail records the address a user asked to change to. The
+// account keeps its current email until ConfirmPendingEmail is called.
+func (m UserModel) SetPendingEmail(id int64, email string) error {
+	query := `
+		update users
+		set pending_email = $1
+		where id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, email, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// ConfirmPendingEmail makes the pending email the user's address.
+func (m UserModel) ConfirmPendingEmail(id int64) error {
+	query := `
+		update users
+		set email = pending_email, pending_email = null, version = version + 1
+		where id = $1 and pending_email is not null
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateError
+		default:
+			return err
+		}
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func (m UserModel) GetForToken(tokenScope string, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		select users.id, users.created_at, users.name, users.email, users.password_hash, users.activation, users.version
+		from users
+		inner join tokens on users.id = tokens.user_id
+		where tokens.hash = $1 and tokens.scope = $2 and tokens.expiry > $3
+	`
+
+	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activation,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrorRecordNotFound
+	}
+
+	query := `
+		select id, created_at, name, email, password_hash, activation, version
+		from users
+		where id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activation,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrorRecordNotFound
+	}
+
+	query := `
+		delete from users
+		where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRow, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRow == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll lists users whose name or email contains search, case-insensitively.
+func (m UserModel) GetAll(search string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		select count(*) over(), id, created_at, name, email, activation, version
+		from users
+		where ($1 = '' or strpos(email, $1::citext) > 0 or strpos(lower(name), lower($1)) > 0)
+		order by %s %s, id asc
+		limit $2 offset $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecord := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecord,
+			&user.Id,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activation,
+			&user.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecord, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
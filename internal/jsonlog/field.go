@@ -0,0 +1,87 @@
+package jsonlog
+
+import (
+	"context"
+	"time"
+)
+
+// Field is a typed property of a log entry. Values are encoded with
+// encoding/json, so maps and structs come out as nested objects.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is written in time.Duration's string form, such as "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value.String()}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value.UTC().Format(time.RFC3339Nano)}
+}
+
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Err(err error) Field {
+	return Field{Key: "error", Value: err.Error()}
+}
+
+func stringFields(properties map[string]string) []Field {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	fields := make([]Field, 0, len(properties))
+	for key, value := range properties {
+		fields = append(fields, String(key, value))
+	}
+
+	return fields
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying fields, on top of any already in
+// ctx, for FromContext to pick up further down the call chain.
+func NewContext(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+
+	combined := make([]Field, 0, len(existing)+len(fields))
+	combined = append(combined, existing...)
+	combined = append(combined, fields...)
+
+	return context.WithValue(ctx, contextKey{}, combined)
+}
+
+func FieldsFromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+// FromContext returns a child logger with the fields stored in ctx.
+func (l *Logger) FromContext(ctx context.Context) *Logger {
+	return l.With(FieldsFromContext(ctx)...)
+}
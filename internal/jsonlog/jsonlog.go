@@ -2,9 +2,11 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,7 +14,9 @@ import (
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,8 +24,12 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
@@ -31,51 +39,182 @@ func (l Level) String() string {
 	}
 }
 
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	case "FATAL":
+		return LevelFatal, nil
+	case "OFF":
+		return LevelOff, nil
+	default:
+		return LevelOff, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Output is a destination for log entries. Entries below Minimum are not
+// written to it.
+type Output struct {
+	Writer  io.Writer
+	Minimum Level
+}
+
+// core is shared by a logger and every child created from it with With.
+type core struct {
+	outputs  []Output
+	minimum  Level
+	traces   map[Level]bool
+	redactor *Redactor
+	mut      sync.Mutex
+}
+
 type Logger struct {
-	out     io.Writer
-	minimum Level
-	mut     sync.Mutex
+	core   *core
+	fields []Field
 }
 
+// New creates a logger writing entries at or above minimum to out. Errors
+// and fatal entries include a stack trace until SetStackTraces says
+// otherwise.
 func New(out io.Writer, minimum Level) *Logger {
+	return NewMulti(Output{Writer: out, Minimum: minimum})
+}
+
+// NewMulti creates a logger that writes every entry to each output whose
+// minimum level it reaches. Properties matching DefaultRedactPatterns are
+// masked until SetRedactor says otherwise.
+func NewMulti(outputs ...Output) *Logger {
+	minimum := LevelOff
+	for _, output := range outputs {
+		if output.Minimum < minimum {
+			minimum = output.Minimum
+		}
+	}
+
 	return &Logger{
-		out:     out,
-		minimum: minimum,
+		core: &core{
+			outputs:  outputs,
+			minimum:  minimum,
+			traces:   map[Level]bool{LevelError: true, LevelFatal: true},
+			redactor: defaultRedactor,
+		},
+	}
+}
+
+var defaultRedactor, _ = NewRedactor(DefaultRedactPatterns...)
+
+// SetRedactor replaces the redactor for this logger and all loggers sharing
+// its output. A nil redactor turns redaction off. It is meant to be called
+// once at startup.
+func (l *Logger) SetRedactor(r *Redactor) {
+	l.core.redactor = r
+}
+
+// SetStackTraces sets the levels whose entries include a stack trace, for
+// this logger and all loggers sharing its output. It is meant to be called
+// once at startup.
+func (l *Logger) SetStackTraces(levels ...Level) {
+	traces := make(map[Level]bool, len(levels))
+	for _, level := range levels {
+		traces[level] = true
+	}
+	l.core.traces = traces
+}
+
+// With returns a child logger that adds fields to every entry it writes.
+func (l *Logger) With(fields ...Field) *Logger {
+	if len(fields) == 0 {
+		return l
 	}
+
+	combined := make([]Field, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+
+	return &Logger{core: l.core, fields: combined}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.core.minimum
+}
+
+func (l *Logger) Debug(message string, fields ...Field) {
+	l.print(LevelDebug, message, fields)
+}
+
+func (l *Logger) Info(message string, fields ...Field) {
+	l.print(LevelInfo, message, fields)
+}
+
+func (l *Logger) Warn(message string, fields ...Field) {
+	l.print(LevelWarn, message, fields)
+}
+
+func (l *Logger) Error(err error, fields ...Field) {
+	l.print(LevelError, err.Error(), fields)
+}
+
+func (l *Logger) Fatal(err error, fields ...Field) {
+	l.print(LevelFatal, err.Error(), fields)
+	l.Close()
+	os.Exit(1)
 }
 
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.print(LevelInfo, message, stringFields(properties))
 }
 
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.print(LevelError, err.Error(), stringFields(properties))
 }
 
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.print(LevelFatal, err.Error(), stringFields(properties))
+	l.Close()
 	os.Exit(1)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minimum {
+func (l *Logger) print(level Level, message string, fields []Field) (int, error) {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
 
+	var properties map[string]interface{}
+
+	if len(l.fields)+len(fields) > 0 {
+		properties = make(map[string]interface{}, len(l.fields)+len(fields))
+		for _, field := range l.fields {
+			properties[field.Key] = field.Value
+		}
+		for _, field := range fields {
+			properties[field.Key] = field.Value
+		}
+	}
+
+	return l.write(level, time.Now(), message, properties)
+}
+
+func (l *Logger) write(level Level, t time.Time, message string, properties map[string]interface{}) (int, error) {
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string                 `json:"level"`
+		Time       string                 `json:"time"`
+		Message    string                 `json:"message"`
+		Properties map[string]interface{} `json:"properties,omitempty"`
+		Trace      string                 `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
-		Time:       time.Now().UTC().Format(time.RFC3339),
-		Message:    message,
-		Properties: properties,
+		Time:       t.UTC().Format(time.RFC3339),
+		Message:    l.core.redactor.redactMessage(message),
+		Properties: l.core.redactor.redact(properties),
 	}
 
-	if level >= LevelError {
+	if l.core.traces[level] {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -83,10 +222,62 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 	if err != nil {
 		line = []byte(LevelError.String() + ": Unable to Marshal the log Message " + err.Error())
 	}
+	line = append(line, '\n')
+
+	l.core.mut.Lock()
+	defer l.core.mut.Unlock()
+
+	var n int
+	var writeErr error
+
+	for _, output := range l.core.outputs {
+		if level < output.Minimum {
+			continue
+		}
+
+		written, err := output.Writer.Write(line)
+		if err != nil && writeErr == nil {
+			writeErr = err
+		}
+		n = written
+	}
+
+	return n, writeErr
+}
+
+// Dropped returns how many entries the asynchronous outputs have discarded
+// because their buffer was full.
+func (l *Logger) Dropped() uint64 {
+	var dropped uint64
+	for _, output := range l.core.outputs {
+		if async, ok := output.Writer.(*Async); ok {
+			dropped += async.Dropped()
+		}
+	}
+	return dropped
+}
+
+// Close flushes asynchronous outputs and closes rotating files. Other
+// writers, such as os.Stdout, are left open.
+func (l *Logger) Close() error {
+	var err error
+
+	for _, output := range l.core.outputs {
+		w := output.Writer
+
+		if async, ok := w.(*Async); ok {
+			async.Close()
+			w = async.out
+		}
+
+		if file, ok := w.(*RotatingFile); ok {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
 
-	l.mut.Lock()
-	defer l.mut.Unlock()
-	return l.out.Write(line)
+	return err
 }
 
 func (l *Logger) Write(line []byte) (n int, err error) {
@@ -0,0 +1,161 @@
+package jsonlog
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// messageURL matches URL-like words with a query string, which may
+	// appear inside error messages such as `Get "https://...?token=...": EOF`.
+	messageURL = regexp.MustCompile(`[^\s"'<>]+\?[^\s"'<>]+`)
+
+	// messageCredential matches the credentials accepted in the
+	// Authorization header, keeping the scheme so the line stays readable.
+	messageCredential = regexp.MustCompile(`(?i)\b(Bearer|ApiKey)\s+[A-Za-z0-9._~+/=-]+`)
+
+	messageEmail = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+)
+
+var DefaultRedactPatterns = []string{"password", "token", "authorization", "email", "secret"}
+
+// Redactor masks the values of properties whose key matches one of its
+// patterns, at any depth, and the matching query parameters of URLs found in
+// string values. While it has any patterns, it also masks credentials and
+// email addresses found in messages.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles patterns as case-insensitive regular expressions,
+// matched anywhere in a key, so "token" also covers "authentication_token".
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	r := &Redactor{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		rx, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		r.patterns = append(r.patterns, rx)
+	}
+
+	return r, nil
+}
+
+func (r *Redactor) sensitive(key string) bool {
+	for _, rx := range r.patterns {
+		if rx.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns properties with sensitive values masked. Maps are copied
+// rather than changed since they may belong to the caller.
+func (r *Redactor) redact(properties map[string]interface{}) map[string]interface{} {
+	if r == nil || len(r.patterns) == 0 || properties == nil {
+		return properties
+	}
+
+	return r.redactValue(properties).(map[string]interface{})
+}
+
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			if r.sensitive(key) {
+				out[key] = redacted
+			} else {
+				out[key] = r.redactValue(nested)
+			}
+		}
+		return out
+
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for key, nested := range v {
+			if r.sensitive(key) {
+				out[key] = redacted
+			} else {
+				out[key] = r.redactURL(nested)
+			}
+		}
+		return out
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, nested := range v {
+			out[i] = r.redactValue(nested)
+		}
+		return out
+
+	case string:
+		return r.redactURL(v)
+
+	default:
+		return value
+	}
+}
+
+// redactMessage masks credentials, email addresses and sensitive query
+// parameters in a free-form message. Unlike properties, messages have no keys
+// to go by, so errors from the database, the mail server or net/http are
+// scanned for the values themselves.
+func (r *Redactor) redactMessage(message string) string {
+	if r == nil || len(r.patterns) == 0 {
+		return message
+	}
+
+	message = messageURL.ReplaceAllStringFunc(message, r.redactURL)
+	message = messageCredential.ReplaceAllString(message, "$1 "+redacted)
+	message = messageEmail.ReplaceAllString(message, redacted)
+
+	return message
+}
+
+// redactURL masks sensitive query parameters when s is a URL with a query
+// string, such as a logged request URL. Other strings are returned as is.
+func (r *Redactor) redactURL(s string) string {
+	if !strings.Contains(s, "?") || !strings.Contains(s, "=") {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.RawQuery == "" {
+		return s
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return s
+	}
+
+	changed := false
+	for key := range query {
+		if r.sensitive(key) {
+			query[key] = []string{redacted}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return s
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,231 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRedactor(t *testing.T, patterns ...string) *Redactor {
+	t.Helper()
+
+	r, err := NewRedactor(patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestRedactKeyPatterns(t *testing.T) {
+	r := newTestRedactor(t, DefaultRedactPatterns...)
+
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"password", true},
+		{"Password", true},
+		{"authentication_token", true},
+		{"AUTHORIZATION", true},
+		{"new_email", true},
+		{"client_secret", true},
+		{"user_id", false},
+		{"method", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := r.redact(map[string]interface{}{tt.key: "value"})[tt.key]
+
+			if tt.sensitive && got != redacted {
+				t.Errorf("got %v; want it redacted", got)
+			}
+			if !tt.sensitive && got != "value" {
+				t.Errorf("got %v; want it kept", got)
+			}
+		})
+	}
+}
+
+func TestRedactCustomPatterns(t *testing.T) {
+	r := newTestRedactor(t, " ssn ", "", "^card_")
+
+	got := r.redact(map[string]interface{}{
+		"user_ssn":    "123-45-6789",
+		"card_number": "4111111111111111",
+		"discard_id":  "7",
+		"password":    "pa55word",
+	})
+
+	want := map[string]interface{}{
+		"user_ssn":    redacted,
+		"card_number": redacted,
+		"discard_id":  "7",
+		"password":    "pa55word",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if _, err := NewRedactor("("); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRedactNested(t *testing.T) {
+	r := newTestRedactor(t, DefaultRedactPatterns...)
+
+	properties := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":    int64(1),
+			"email": "alice@example.com",
+			"keys": []interface{}{
+				map[string]interface{}{"token": "abc", "name": "ci"},
+			},
+		},
+		"headers": map[string]string{
+			"Authorization": "Bearer abc",
+			"Accept":        "application/json",
+		},
+	}
+
+	want := map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":    int64(1),
+			"email": redacted,
+			"keys": []interface{}{
+				map[string]interface{}{"token": redacted, "name": "ci"},
+			},
+		},
+		"headers": map[string]string{
+			"Authorization": redacted,
+			"Accept":        "application/json",
+		},
+	}
+
+	got := r.redact(properties)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// The caller's maps are left as they were.
+	if properties["user"].(map[string]interface{})["email"] != "alice@example.com" {
+		t.Error("redact changed the caller's nested map")
+	}
+	if properties["headers"].(map[string]string)["Authorization"] != "Bearer abc" {
+		t.Error("redact changed the caller's string map")
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	r := newTestRedactor(t, DefaultRedactPatterns...)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"sensitive parameter", "/api/v1/users/activate?token=abc&page=2", "/api/v1/users/activate?page=2&token=%5BREDACTED%5D"},
+		{"absolute URL", "https://example.com/reset?Password=x", "https://example.com/reset?Password=%5BREDACTED%5D"},
+		{"nothing sensitive", "/api/v1/movies?page=2&sort=-year", "/api/v1/movies?page=2&sort=-year"},
+		{"no query", "/api/v1/movies", "/api/v1/movies"},
+		{"not a URL", "is 2+2=4?", "is 2+2=4?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redactValue(tt.in); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactMessage(t *testing.T) {
+	r := newTestRedactor(t, DefaultRedactPatterns...)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"smtp reply",
+			"550 <alice@example.com>: Recipient address rejected",
+			"550 <[REDACTED]>: Recipient address rejected",
+		},
+		{
+			"bearer token",
+			"invalid credentials: Bearer eyJhbGciOi.eyJzdWIi.c2lnbmF0dXJl",
+			"invalid credentials: Bearer [REDACTED]",
+		},
+		{
+			"api key",
+			"lookup failed for apikey AB12CD34EF56",
+			"lookup failed for apikey [REDACTED]",
+		},
+		{
+			"url in an error",
+			`Get "https://example.com/hook?token=abc": EOF`,
+			`Get "https://example.com/hook?token=%5BREDACTED%5D": EOF`,
+		},
+		{
+			"nothing sensitive",
+			"database connection pool established",
+			"database connection pool established",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redactMessage(tt.in); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	var off *Redactor
+	if got := off.redactMessage(tests[0].in); got != tests[0].in {
+		t.Errorf("nil redactor changed the message to %q", got)
+	}
+}
+
+// TestRedactLines checks every way into the logger masks the message as well
+// as the properties before the line is written.
+func TestRedactLines(t *testing.T) {
+	const secret = "alice@example.com"
+
+	tests := []struct {
+		name string
+		log  func(l *Logger)
+	}{
+		{"Error", func(l *Logger) { l.Error(errors.New("550 <" + secret + ">")) }},
+		{"PrintError", func(l *Logger) { l.PrintError(errors.New("550 <"+secret+">"), map[string]string{"email": secret}) }},
+		{"Info", func(l *Logger) { l.Info("sent", String("email", secret)) }},
+		{"slog", func(l *Logger) { slog.New(NewHandler(l)).Info("sending to " + secret) }},
+		{"ErrorLog", func(l *Logger) { l.Write([]byte("http: TLS handshake error from " + secret + "\n")) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, LevelInfo)
+			l.SetStackTraces()
+
+			tt.log(l)
+
+			if !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+				t.Fatalf("not a JSON line: %s", buf.String())
+			}
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("line contains %q: %s", secret, buf.String())
+			}
+		})
+	}
+}
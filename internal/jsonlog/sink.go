@@ -0,0 +1,247 @@
+package jsonlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Async hands lines to a background goroutine through a bounded buffer so
+// a slow writer never holds up the caller. When the buffer is full the line
+// is dropped and counted instead of blocking.
+type Async struct {
+	out     io.Writer
+	lines   chan []byte
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAsync(out io.Writer, size int) *Async {
+	a := &Async{
+		out:   out,
+		lines: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(a.done)
+		for line := range a.lines {
+			a.out.Write(line)
+		}
+	}()
+
+	return a
+}
+
+func (a *Async) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	select {
+	case a.lines <- line:
+	default:
+		a.dropped.Add(1)
+	}
+
+	return len(p), nil
+}
+
+func (a *Async) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close waits for the buffered lines to be written. Later writes fail.
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.lines)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+
+	return nil
+}
+
+// RotatingFile is a log file that is rotated once it grows past MaxSize
+// bytes or has been open for Interval, whichever comes first. Rotated files
+// are renamed with a timestamp suffix, optionally gzipped, and only the
+// newest MaxBackups are kept. A zero limit disables that rule.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	Interval   time.Duration
+	MaxBackups int
+	Compress   bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// maintenance serialises compressing and pruning, which run in the
+	// background after each rotation.
+	maintenance sync.Mutex
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		err := f.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	tooBig := f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize
+	tooOld := f.Interval > 0 && time.Since(f.openedAt) >= f.Interval
+
+	if tooBig || tooOld {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	// Wait for a pending compression so no half-written archive is left.
+	f.maintenance.Lock()
+	f.maintenance.Unlock()
+
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	err := os.MkdirAll(filepath.Dir(f.Path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+	f.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", f.Path, time.Now().UTC().Format("20060102T150405.000000000"))
+
+	err = os.Rename(f.Path, rotated)
+	if err != nil {
+		return err
+	}
+
+	go f.maintain(rotated)
+
+	return f.open()
+}
+
+func (f *RotatingFile) maintain(rotated string) {
+	f.maintenance.Lock()
+	defer f.maintenance.Unlock()
+
+	if f.Compress {
+		err := compressFile(rotated)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsonlog: compressing %s: %v\n", rotated, err)
+		}
+	}
+
+	if f.MaxBackups > 0 {
+		backups, err := filepath.Glob(f.Path + ".*")
+		if err != nil {
+			return
+		}
+
+		// The timestamp suffix sorts in rotation order.
+		sort.Strings(backups)
+
+		for len(backups) > f.MaxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
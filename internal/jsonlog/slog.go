@@ -0,0 +1,156 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Handler is a slog.Handler that writes through a Logger, so records from
+// log/slog come out in the same schema and to the same outputs as entries
+// logged directly. Groups become nested objects under "properties".
+type Handler struct {
+	logger *Logger
+	attrs  []groupedAttr
+	groups []string
+}
+
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+func NewHandler(logger *Logger) *Handler {
+	return &Handler{logger: logger}
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	properties := make(map[string]interface{})
+
+	for _, field := range h.logger.fields {
+		properties[field.Key] = field.Value
+	}
+	for _, field := range FieldsFromContext(ctx) {
+		properties[field.Key] = field.Value
+	}
+
+	for _, ga := range h.attrs {
+		addAttr(properties, ga.groups, ga.attr)
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(properties, h.groups, attr)
+		return true
+	})
+
+	if len(properties) == 0 {
+		properties = nil
+	}
+
+	t := record.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	_, err := h.logger.write(fromSlogLevel(record.Level), t, record.Message, properties)
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.attrs = make([]groupedAttr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+	for _, attr := range attrs {
+		h2.attrs = append(h2.attrs, groupedAttr{groups: h.groups, attr: attr})
+	}
+
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.groups = make([]string, 0, len(h.groups)+1)
+	h2.groups = append(h2.groups, h.groups...)
+	h2.groups = append(h2.groups, name)
+
+	return &h2
+}
+
+func addAttr(properties map[string]interface{}, groups []string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	for _, group := range groups {
+		nested, ok := properties[group].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			properties[group] = nested
+		}
+		properties = nested
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		members := attr.Value.Group()
+		if len(members) == 0 {
+			return
+		}
+
+		// An unnamed group is inlined into its parent.
+		var path []string
+		if attr.Key != "" {
+			path = []string{attr.Key}
+		}
+		for _, member := range members {
+			addAttr(properties, path, member)
+		}
+		return
+	}
+
+	properties[attr.Key] = slogValue(attr.Value)
+}
+
+// slogValue converts values the way the Field constructors do, so the same
+// data looks the same whichever API logged it.
+func slogValue(value slog.Value) interface{} {
+	switch value.Kind() {
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindTime:
+		return value.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return err.Error()
+		}
+		return value.Any()
+	default:
+		return value.Any()
+	}
+}
@@ -0,0 +1,388 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("Invalid Patch Document")
+	ErrTestFailed   = errors.New("Patch Test Operation Failed")
+)
+
+// OperationError reports a JSON Patch operation that could not be applied
+// to the target document.
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies an RFC 6902 JSON Patch to doc and returns the resulting
+// document. Operations are applied in order and the whole patch fails if any
+// single operation fails.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	for i, op := range ops {
+		var err error
+		target, err = applyOperation(target, op)
+		if err != nil {
+			if errors.Is(err, ErrTestFailed) || errors.Is(err, ErrInvalidPatch) {
+				return nil, err
+			}
+
+			path := ""
+			if op.Path != nil {
+				path = *op.Path
+			}
+			return nil, &OperationError{Index: i, Op: op.Op, Path: path, Err: err.Error()}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, ErrInvalidPatch
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, ErrInvalidPatch
+		}
+
+		var value interface{}
+		if err := decode(op.Value, &value); err != nil {
+			return nil, ErrInvalidPatch
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			doc, _, err = remove(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, ErrInvalidPatch
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("cannot move a value into one of its children")
+			}
+
+			var value interface{}
+			doc, value, err = remove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+
+	default:
+		return nil, ErrInvalidPatch
+	}
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("cannot traverse into %q", token)
+		}
+	}
+
+	return current, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+
+		return replaceParent(doc, path[:len(path)-1], node)
+	default:
+		return nil, fmt.Errorf("cannot add member %q to a scalar value", last)
+	}
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+
+		doc, err = replaceParent(doc, path[:len(path)-1], node)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove member %q from a scalar value", last)
+	}
+}
+
+// replaceParent stores a resized array back at path, since growing or
+// shrinking a slice does not update the slice held by its container.
+func replaceParent(doc interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+
+	container, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+
+	switch node := container.(type) {
+	case map[string]interface{}:
+		node[last] = array
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = array
+	}
+
+	return doc, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = deepCopy(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = deepCopy(item)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func equal(a interface{}, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		xf, errX := x.Float64()
+		yf, errY := y.Float64()
+		return errX == nil && errY == nil && xf == yf
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,366 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result is not valid JSON: %v: %s", err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("expected value is not valid JSON: %v: %s", err, want)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+// Examples from RFC 6902, Appendix A.
+func TestApplyRFC6902Examples(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:    "A.9 testing a value: error",
+			doc:     `{"baz":"qux"}`,
+			patch:   `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:    "A.12 adding to a nonexistent target",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:    "A.15 comparing strings and numbers",
+			doc:     `{"/":9,"~1":10}`,
+			patch:   `[{"op":"test","path":"/~01","value":"10"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "~1 escapes a slash in a member name",
+			doc:   `{"a/b":1}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":2}]`,
+			want:  `{"a/b":2}`,
+		},
+		{
+			name:  "~0 escapes a tilde in a member name",
+			doc:   `{"m~n":1}`,
+			patch: `[{"op":"remove","path":"/m~0n"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "- appends to a nested array",
+			doc:   `{"a":{"b":[1]}}`,
+			patch: `[{"op":"add","path":"/a/b/-","value":2}]`,
+			want:  `{"a":{"b":[1,2]}}`,
+		},
+		{
+			name:    "- is not a valid index for remove",
+			doc:     `{"a":[1]}`,
+			patch:   `[{"op":"remove","path":"/a/-"}]`,
+			wantErr: &OperationError{},
+		},
+		{
+			name:    "leading zeros are not a valid index",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"remove","path":"/a/01"}]`,
+			wantErr: &OperationError{},
+		},
+		{
+			name:    "add past the end of an array",
+			doc:     `{"a":[1]}`,
+			patch:   `[{"op":"add","path":"/a/2","value":3}]`,
+			wantErr: &OperationError{},
+		},
+		{
+			name:    "replace a missing member",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"replace","path":"/b","value":2}]`,
+			wantErr: &OperationError{},
+		},
+		{
+			name:  "add replaces the whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"","value":[1,2]}]`,
+			want:  `[1,2]`,
+		},
+		{
+			name:  "test compares numbers by value",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"test","path":"/a","value":1.0}]`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "test compares objects regardless of member order",
+			doc:   `{"a":{"x":1,"y":[true,null]}}`,
+			patch: `[{"op":"test","path":"/a","value":{"y":[true,null],"x":1}}]`,
+			want:  `{"a":{"x":1,"y":[true,null]}}`,
+		},
+		{
+			name:    "test failure is reported as ErrTestFailed",
+			doc:     `{"a":[1,2]}`,
+			patch:   `[{"op":"test","path":"/a","value":[2,1]}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "a failed test rolls back earlier operations",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "move into one of its own children",
+			doc:     `{"a":{"b":{}}}`,
+			patch:   `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			wantErr: &OperationError{},
+		},
+		{
+			name:  "move to the same location",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"move","from":"/a/b","path":"/a/b"}]`,
+			want:  `{"a":{"b":1}}`,
+		},
+		{
+			name:  "copy is deep",
+			doc:   `{"a":{"b":[1]}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+			want:  `{"a":{"b":[1]},"c":{"b":[1,2]}}`,
+		},
+		{
+			name:  "copy an array element to the end",
+			doc:   `{"a":["x","y"]}`,
+			patch: `[{"op":"copy","from":"/a/0","path":"/a/-"}]`,
+			want:  `{"a":["x","y","x"]}`,
+		},
+		{
+			name:    "copy without from",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"copy","path":"/b"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "add without value",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"add","path":"/b"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:  "add with a null value",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/b","value":null}]`,
+			want:  `{"a":1,"b":null}`,
+		},
+		{
+			name:    "unknown operation",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"frobnicate","path":"/a"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "patch that is not an array",
+			doc:     `{"a":1}`,
+			patch:   `{"op":"remove","path":"/a"}`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "pointer without a leading slash",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"remove","path":"a"}]`,
+			wantErr: &OperationError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+
+				var opErr *OperationError
+				switch {
+				case errors.As(tt.wantErr, &opErr):
+					if !errors.As(err, &opErr) {
+						t.Fatalf("got error %v; want an *OperationError", err)
+					}
+				case !errors.Is(err, tt.wantErr):
+					t.Fatalf("got error %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+// Examples from RFC 7396, Appendix A.
+func TestMergePatchRFC7396Examples(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" + "+tt.patch, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"malformed patch", `{"a":1}`, `{"a":`},
+		{"trailing data", `{"a":1}`, `{"a":2} {"b":3}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, ErrInvalidPatch) {
+				t.Fatalf("got error %v; want %v", err, ErrInvalidPatch)
+			}
+		})
+	}
+}
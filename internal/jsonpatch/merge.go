@@ -0,0 +1,62 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to doc and returns the
+// resulting document.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var p interface{}
+	if err := decode(patch, &p); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+func decode(js []byte, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return err
+	}
+
+	if err = dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("document must contain a single JSON value")
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken = errors.New("Invalid Token")
+	ErrExpiredToken = errors.New("Expired Token")
+	ErrUnknownKey   = errors.New("Unknown Signing Key")
+)
+
+// Audience accepts both the string and the array form of the "aud" claim.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(js []byte) error {
+	var single string
+	if err := json.Unmarshal(js, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(js, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+type Claims struct {
+	Subject     string   `json:"sub"`
+	Issuer      string   `json:"iss,omitempty"`
+	Audience    Audience `json:"aud,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+	NotBefore   int64    `json:"nbf,omitempty"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Key is a signing or verification key. HMAC keys can do both; Ed25519 keys
+// loaded from a public key file can only verify.
+type Key struct {
+	ID         string
+	Algorithm  string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func (k Key) CanSign() bool {
+	return k.secret != nil || k.privateKey != nil
+}
+
+// LoadKey reads a key file. PEM encoded PKCS#8 private keys and PKIX public
+// keys are loaded as Ed25519 keys; anything else is used as an HMAC secret.
+func LoadKey(path string) (Key, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		secret := []byte(strings.TrimSpace(string(contents)))
+		if len(secret) < 32 {
+			return Key{}, fmt.Errorf("%s: HMAC secret must be at least 32 bytes long", path)
+		}
+		return NewHMACKey(secret), nil
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("%s: %w", path, err)
+		}
+		privateKey, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, fmt.Errorf("%s: private key is not an Ed25519 key", path)
+		}
+		return NewEd25519Key(privateKey.Public().(ed25519.PublicKey), privateKey), nil
+
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("%s: %w", path, err)
+		}
+		publicKey, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, fmt.Errorf("%s: public key is not an Ed25519 key", path)
+		}
+		return NewEd25519Key(publicKey, nil), nil
+
+	default:
+		return Key{}, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+}
+
+func NewHMACKey(secret []byte) Key {
+	return Key{
+		ID:        keyID(secret),
+		Algorithm: AlgorithmHS256,
+		secret:    secret,
+	}
+}
+
+// NewEd25519Key builds an Ed25519 key. privateKey may be nil for a
+// verification-only key.
+func NewEd25519Key(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey) Key {
+	return Key{
+		ID:         keyID(publicKey),
+		Algorithm:  AlgorithmEdDSA,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}
+}
+
+// keyID derives a stable "kid" from the key material so that every replica
+// loading the same file advertises the same id.
+func keyID(material []byte) string {
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (k Key) sign(signingInput []byte) ([]byte, error) {
+	switch {
+	case k.secret != nil:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	case k.privateKey != nil:
+		return ed25519.Sign(k.privateKey, signingInput), nil
+	default:
+		return nil, errors.New("key cannot sign")
+	}
+}
+
+func (k Key) verify(signingInput []byte, signature []byte) bool {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		expected, _ := k.sign(signingInput)
+		return subtle.ConstantTimeCompare(expected, signature) == 1
+	case AlgorithmEdDSA:
+		return ed25519.Verify(k.publicKey, signingInput, signature)
+	default:
+		return false
+	}
+}
+
+func Sign(key Key, claims Claims) (string, error) {
+	if !key.CanSign() {
+		return "", errors.New("key cannot sign")
+	}
+
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verifier checks tokens against a set of active keys, which lets a new
+// signing key be rolled out while tokens signed by the old one are still
+// accepted.
+type Verifier struct {
+	keys     map[string]Key
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// NewVerifier returns a verifier accepting tokens signed by any of keys.
+// An empty issuer or audience is not checked.
+func NewVerifier(issuer string, audience string, leeway time.Duration, keys ...Key) *Verifier {
+	v := &Verifier{
+		keys:     make(map[string]Key, len(keys)),
+		issuer:   issuer,
+		audience: audience,
+		leeway:   leeway,
+	}
+
+	for _, key := range keys {
+		v.keys[key.ID] = key
+	}
+
+	return v
+}
+
+func (v *Verifier) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, found := v.keys[h.KeyID]
+	if !found {
+		return nil, ErrUnknownKey
+	}
+
+	// The algorithm is pinned by the key, never taken from the token alone.
+	if h.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(v.leeway)) {
+		return nil, ErrExpiredToken
+	}
+
+	if claims.NotBefore != 0 && now.Add(v.leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.IssuedAt != 0 && now.Add(v.leeway).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, ErrInvalidToken
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, ErrInvalidToken
+	}
+
+	if v.audience != "" {
+		matched := false
+		for _, aud := range claims.Audience {
+			if aud == v.audience {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,247 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+func newEd25519TestKey(t *testing.T) Key {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewEd25519Key(publicKey, privateKey)
+}
+
+func validClaims() Claims {
+	return Claims{
+		Subject:   "1",
+		Issuer:    "rest",
+		Audience:  Audience{"rest"},
+		IssuedAt:  testNow.Unix(),
+		ExpiresAt: testNow.Add(15 * time.Minute).Unix(),
+	}
+}
+
+func sign(t *testing.T, key Key, claims Claims) string {
+	t.Helper()
+
+	token, err := Sign(key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// forge builds a token from a raw header, letting tests pick the "alg" and
+// "kid" an attacker would send.
+func forge(rawHeader string, claims string, signature []byte) string {
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString([]byte(rawHeader)) + "." + enc.EncodeToString([]byte(claims))
+	return signingInput + "." + enc.EncodeToString(signature)
+}
+
+func TestVerifyAlgorithmPinning(t *testing.T) {
+	key := newEd25519TestKey(t)
+	verifier := NewVerifier("rest", "rest", 0, key)
+
+	claims := `{"sub":"1","iss":"rest","aud":"rest","exp":1700000900}`
+
+	noneToken := forge(`{"alg":"none","typ":"JWT","kid":"`+key.ID+`"}`, claims, nil)
+
+	// An HS256 token keyed with the public key, which an attacker can know.
+	hsHeader := `{"alg":"HS256","typ":"JWT","kid":"` + key.ID + `"}`
+	enc := base64.RawURLEncoding
+	mac := hmac.New(sha256.New, key.publicKey)
+	mac.Write([]byte(enc.EncodeToString([]byte(hsHeader)) + "." + enc.EncodeToString([]byte(claims))))
+	hsToken := forge(hsHeader, claims, mac.Sum(nil))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"alg none", noneToken},
+		{"HS256 with the EdDSA public key as secret", hsToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.token, testNow)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("got %v; want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+
+	if _, err := verifier.Verify(sign(t, key, validClaims()), testNow); err != nil {
+		t.Fatalf("valid EdDSA token rejected: %v", err)
+	}
+}
+
+func TestVerifyTimeClaims(t *testing.T) {
+	key := NewHMACKey([]byte("0123456789abcdef0123456789abcdef"))
+	leeway := 30 * time.Second
+	verifier := NewVerifier("rest", "rest", leeway, key)
+
+	tests := []struct {
+		name    string
+		modify  func(c *Claims)
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name: "valid",
+			now:  testNow,
+		},
+		{
+			name:   "expired within leeway",
+			modify: func(c *Claims) { c.ExpiresAt = testNow.Add(-leeway / 2).Unix() },
+			now:    testNow,
+		},
+		{
+			name:    "expired beyond leeway",
+			modify:  func(c *Claims) { c.ExpiresAt = testNow.Add(-leeway - time.Second).Unix() },
+			now:     testNow,
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name:    "missing exp",
+			modify:  func(c *Claims) { c.ExpiresAt = 0 },
+			now:     testNow,
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name:   "not yet valid within leeway",
+			modify: func(c *Claims) { c.NotBefore = testNow.Add(leeway / 2).Unix() },
+			now:    testNow,
+		},
+		{
+			name:    "not yet valid beyond leeway",
+			modify:  func(c *Claims) { c.NotBefore = testNow.Add(leeway + time.Second).Unix() },
+			now:     testNow,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "issued in the future",
+			modify:  func(c *Claims) { c.IssuedAt = testNow.Add(leeway + time.Second).Unix() },
+			now:     testNow,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.modify != nil {
+				tt.modify(&claims)
+			}
+
+			_, err := verifier.Verify(sign(t, key, claims), tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIssuerAndAudience(t *testing.T) {
+	key := NewHMACKey([]byte("0123456789abcdef0123456789abcdef"))
+	verifier := NewVerifier("rest", "rest", 0, key)
+
+	tests := []struct {
+		name    string
+		modify  func(c *Claims)
+		wantErr error
+	}{
+		{name: "matching issuer and audience"},
+		{
+			name:   "audience among several",
+			modify: func(c *Claims) { c.Audience = Audience{"other", "rest"} },
+		},
+		{
+			name:    "other audience",
+			modify:  func(c *Claims) { c.Audience = Audience{"other"} },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "missing audience",
+			modify:  func(c *Claims) { c.Audience = nil },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "other issuer",
+			modify:  func(c *Claims) { c.Issuer = "someone-else" },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "missing issuer",
+			modify:  func(c *Claims) { c.Issuer = "" },
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.modify != nil {
+				tt.modify(&claims)
+			}
+
+			_, err := verifier.Verify(sign(t, key, claims), testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	oldKey := newEd25519TestKey(t)
+	newKey := newEd25519TestKey(t)
+	retiredKey := newEd25519TestKey(t)
+
+	// The new key signs; the old one is still accepted for verification.
+	verifier := NewVerifier("rest", "rest", 0, newKey, NewEd25519Key(oldKey.publicKey, nil))
+
+	// A token signed by the old key but claiming the new key's kid.
+	swapped := sign(t, oldKey, validClaims())
+	enc := base64.RawURLEncoding
+	parts := strings.Split(swapped, ".")
+	swapped = enc.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT","kid":"`+newKey.ID+`"}`)) + "." + parts[1] + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"signed by the new key", sign(t, newKey, validClaims()), nil},
+		{"signed by the old key", sign(t, oldKey, validClaims()), nil},
+		{"signed by a retired key", sign(t, retiredKey, validClaims()), ErrUnknownKey},
+		{"kid of another key", swapped, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.token, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if NewEd25519Key(oldKey.publicKey, nil).CanSign() {
+		t.Error("a verification-only key must not be able to sign")
+	}
+}
@@ -0,0 +1,30 @@
+package limiter
+
+import (
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the full burst is available again.
+	Reset time.Duration
+	// RetryAfter is how long a denied caller has to wait before the next
+	// request can be allowed. It is zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the request identified by key may proceed. The
+// limit is passed on every call so it can change without losing state.
+// Peek reports what Allow would return without counting a request.
+type Limiter interface {
+	Allow(key string, limit Limit) (Result, error)
+	Peek(key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,238 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced time source shared by a limiter under test.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// limiters returns every Limiter implementation driven by the same clock.
+// The start time lies on a window boundary for all window lengths used
+// below, so each scenario starts with a fresh window.
+func limiters() map[string]func(c *clock) Limiter {
+	return map[string]func(c *clock) Limiter{
+		"TokenBucket": func(c *clock) Limiter {
+			l := NewTokenBucket()
+			l.now = c.now
+			return l
+		},
+		"SlidingWindow": func(c *clock) Limiter {
+			l := NewSlidingWindow(NewMemoryStore())
+			l.now = c.now
+			return l
+		},
+	}
+}
+
+var testLimit = Limit{Rate: 1, Burst: 5}
+
+func newClock() *clock {
+	return &clock{t: time.Unix(1_700_000_000, 0)}
+}
+
+func allow(t *testing.T, l Limiter, key string, limit Limit) Result {
+	t.Helper()
+
+	result, err := l.Allow(key, limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return result
+}
+
+// exhaust uses up the burst of key and returns the first denied result.
+func exhaust(t *testing.T, l Limiter, key string, limit Limit) Result {
+	t.Helper()
+
+	for i := 0; i < limit.Burst; i++ {
+		if result := allow(t, l, key, limit); !result.Allowed {
+			t.Fatalf("request %d denied within the burst", i+1)
+		}
+	}
+
+	result := allow(t, l, key, limit)
+	if result.Allowed {
+		t.Fatal("request beyond the burst allowed")
+	}
+
+	return result
+}
+
+func TestBurst(t *testing.T) {
+	for name, newLimiter := range limiters() {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter(newClock())
+
+			for i := 0; i < testLimit.Burst; i++ {
+				result := allow(t, l, "a", testLimit)
+
+				want := Result{Allowed: true, Limit: testLimit.Burst, Remaining: testLimit.Burst - i - 1}
+				if result.Allowed != want.Allowed || result.Limit != want.Limit || result.Remaining != want.Remaining || result.RetryAfter != 0 {
+					t.Fatalf("request %d: got %+v; want %+v", i+1, result, want)
+				}
+			}
+
+			result := allow(t, l, "a", testLimit)
+			if result.Allowed || result.Remaining != 0 || result.RetryAfter <= 0 || result.Limit != testLimit.Burst {
+				t.Fatalf("request beyond the burst: got %+v", result)
+			}
+
+			if result := allow(t, l, "b", testLimit); !result.Allowed {
+				t.Fatal("another key shares the exhausted burst")
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	// Some requests are made at the start, the rest after offset, so the
+	// sliding window also has a partly overlapping previous window.
+	offsets := []time.Duration{0, 2500 * time.Millisecond, 7 * time.Second}
+
+	for name, newLimiter := range limiters() {
+		for _, offset := range offsets {
+			t.Run(name+"/"+offset.String(), func(t *testing.T) {
+				c := newClock()
+				l := newLimiter(c)
+
+				for i := 0; i < 3; i++ {
+					allow(t, l, "a", testLimit)
+				}
+
+				c.advance(offset)
+
+				denied := allow(t, l, "a", testLimit)
+				for denied.Allowed {
+					denied = allow(t, l, "a", testLimit)
+				}
+
+				if denied.RetryAfter <= 0 {
+					t.Fatalf("got RetryAfter %s; want it positive", denied.RetryAfter)
+				}
+
+				early := denied.RetryAfter / 10
+				c.advance(denied.RetryAfter - early)
+				if result := allow(t, l, "a", testLimit); result.Allowed {
+					t.Fatalf("allowed %s before RetryAfter (%s)", early, denied.RetryAfter)
+				}
+
+				c.advance(early)
+				if result := allow(t, l, "a", testLimit); !result.Allowed {
+					t.Fatalf("denied once RetryAfter (%s) had passed", denied.RetryAfter)
+				}
+			})
+		}
+	}
+}
+
+func TestRefill(t *testing.T) {
+	for name, newLimiter := range limiters() {
+		t.Run(name, func(t *testing.T) {
+			c := newClock()
+			l := newLimiter(c)
+
+			var last Result
+			for i := 0; i < testLimit.Burst; i++ {
+				last = allow(t, l, "a", testLimit)
+			}
+
+			if last.Reset <= 0 {
+				t.Fatalf("got Reset %s after using the burst; want it positive", last.Reset)
+			}
+
+			if result := allow(t, l, "a", testLimit); result.Allowed {
+				t.Fatal("request beyond the burst allowed")
+			}
+
+			// Once Reset has passed the whole burst is available again.
+			c.advance(last.Reset)
+			exhaust(t, l, "a", testLimit)
+		})
+	}
+}
+
+func TestLimitChangeKeepsState(t *testing.T) {
+	faster := Limit{Rate: 2, Burst: testLimit.Burst}
+
+	for name, newLimiter := range limiters() {
+		t.Run(name+"/exhausted", func(t *testing.T) {
+			l := newLimiter(newClock())
+
+			exhaust(t, l, "a", testLimit)
+
+			result := allow(t, l, "a", faster)
+			if result.Allowed {
+				t.Fatal("changing the limit gave an exhausted key a fresh burst")
+			}
+			if result.Limit != faster.Burst {
+				t.Fatalf("got Limit %d; want %d", result.Limit, faster.Burst)
+			}
+		})
+
+		t.Run(name+"/partly used", func(t *testing.T) {
+			l := newLimiter(newClock())
+
+			allow(t, l, "a", testLimit)
+			allow(t, l, "a", testLimit)
+
+			result := allow(t, l, "a", faster)
+			if !result.Allowed || result.Remaining != faster.Burst-3 {
+				t.Fatalf("got %+v; want allowed with %d remaining", result, faster.Burst-3)
+			}
+		})
+	}
+}
+
+func TestZeroLimitDenies(t *testing.T) {
+	for name, newLimiter := range limiters() {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter(newClock())
+
+			result := allow(t, l, "a", Limit{Rate: 0, Burst: 0})
+			if result.Allowed || result.RetryAfter <= 0 {
+				t.Fatalf("got %+v; want denied with a RetryAfter", result)
+			}
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	for name, newLimiter := range limiters() {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter(newClock())
+
+			for i := 0; i < 2; i++ {
+				result, err := l.Peek("a", testLimit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed || result.Remaining != testLimit.Burst {
+					t.Fatalf("peek %d: got %+v; want allowed with the full burst remaining", i+1, result)
+				}
+			}
+
+			denied := exhaust(t, l, "a", testLimit)
+
+			result, err := l.Peek("a", testLimit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.RetryAfter != denied.RetryAfter {
+				t.Fatalf("got %+v; want denied with RetryAfter %s", result, denied.RetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package limiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/root-root1/rest/internal/realip"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	IdentityIP     = "ip"
+	IdentityUser   = "user"
+	IdentityAPIKey = "api_key"
+)
+
+// Policy applies a limit to the requests matching Method, Path and Identity.
+// Empty fields match everything. Path segments starting with ":" match any
+// single segment and a trailing "*" matches the rest of the path.
+type Policy struct {
+	Name     string  `json:"name"`
+	Method   string  `json:"method"`
+	Path     string  `json:"path"`
+	Identity string  `json:"identity"`
+	Rate     float64 `json:"rps"`
+	Burst    int     `json:"burst"`
+}
+
+func (p Policy) Limit() Limit {
+	return Limit{Rate: p.Rate, Burst: p.Burst}
+}
+
+// Policies is the policy file. The first matching policy wins; requests
+// matching none use Default. Addresses in Allow are never limited and those
+// in Deny are refused outright.
+type Policies struct {
+	Default  Policy   `json:"default"`
+	Policies []Policy `json:"policies"`
+	Allow    []string `json:"allow"`
+	Deny     []string `json:"deny"`
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// LoadPolicies reads a JSON policy file. fallback is used as the default
+// policy when the file doesn't set one.
+func LoadPolicies(path string, fallback Limit) (*Policies, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var policies Policies
+
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&policies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if policies.Default.Rate == 0 && policies.Default.Burst == 0 {
+		policies.Default.Rate = fallback.Rate
+		policies.Default.Burst = fallback.Burst
+	}
+
+	err = policies.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &policies, nil
+}
+
+func DefaultPolicies(limit Limit) *Policies {
+	return &Policies{
+		Default: Policy{Name: "default", Rate: limit.Rate, Burst: limit.Burst},
+	}
+}
+
+// Validate checks the policies and prepares them for use. It must be called
+// again after any field is changed.
+func (p *Policies) Validate() error {
+	if p.Default.Name == "" {
+		p.Default.Name = "default"
+	}
+
+	if p.Default.Rate <= 0 || p.Default.Burst <= 0 {
+		return errors.New("default policy must have a positive rps and burst")
+	}
+
+	names := map[string]bool{p.Default.Name: true}
+
+	for i := range p.Policies {
+		policy := &p.Policies[i]
+
+		if policy.Name == "" {
+			policy.Name = strings.TrimSpace(policy.Method + " " + policy.Path + " " + policy.Identity)
+		}
+
+		if names[policy.Name] {
+			return fmt.Errorf("policy %q is defined more than once", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if policy.Rate <= 0 || policy.Burst <= 0 {
+			return fmt.Errorf("policy %q must have a positive rps and burst", policy.Name)
+		}
+
+		switch policy.Identity {
+		case "", IdentityIP, IdentityUser, IdentityAPIKey:
+		default:
+			return fmt.Errorf("policy %q has unknown identity %q", policy.Name, policy.Identity)
+		}
+
+		policy.Method = strings.ToUpper(policy.Method)
+	}
+
+	var err error
+
+	p.allow, err = realip.ParseNetworks(p.Allow)
+	if err != nil {
+		return fmt.Errorf("allow: %w", err)
+	}
+
+	p.deny, err = realip.ParseNetworks(p.Deny)
+	if err != nil {
+		return fmt.Errorf("deny: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Policies) Allowed(ip net.IP) bool {
+	return realip.Contains(p.allow, ip)
+}
+
+func (p *Policies) Denied(ip net.IP) bool {
+	return realip.Contains(p.deny, ip)
+}
+
+func (p *Policies) Match(method string, path string, identity string) Policy {
+	for _, policy := range p.Policies {
+		if policy.Method != "" && policy.Method != method {
+			continue
+		}
+		if policy.Identity != "" && policy.Identity != identity {
+			continue
+		}
+		if policy.Path != "" && !matchPath(policy.Path, path) {
+			continue
+		}
+		return policy
+	}
+
+	return p.Default
+}
+
+func matchPath(pattern string, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range patternParts {
+		if part == "*" && i == len(patternParts)-1 {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(pathParts)
+}
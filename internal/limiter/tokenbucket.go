@@ -0,0 +1,122 @@
+package limiter
+
+import (
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// TokenBucket keeps one token bucket per key in process memory. It is exact
+// but every replica keeps its own buckets.
+type TokenBucket struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewTokenBucket() *TokenBucket {
+	l := &TokenBucket{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if time.Since(b.lastSeen) > 3*time.Minute {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+
+	return l
+}
+
+func (l *TokenBucket) Allow(key string, limit Limit) (Result, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, limit, now)
+
+	result := Result{Limit: limit.Burst}
+
+	reservation := b.limiter.ReserveN(now, 1)
+	switch {
+	case !reservation.OK():
+		result.RetryAfter = time.Minute
+	case reservation.DelayFrom(now) > 0:
+		result.RetryAfter = reservation.DelayFrom(now)
+		reservation.CancelAt(now)
+	default:
+		result.Allowed = true
+	}
+
+	return l.remaining(result, b, limit, now), nil
+}
+
+// Peek reports what Allow would return without taking a token.
+func (l *TokenBucket) Peek(key string, limit Limit) (Result, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, limit, now)
+
+	result := Result{Limit: limit.Burst}
+
+	tokens := b.limiter.TokensAt(now)
+	switch {
+	case tokens >= 1:
+		result.Allowed = true
+	case limit.Rate > 0 && limit.Burst > 0:
+		result.RetryAfter = time.Duration(math.Ceil((1 - tokens) / limit.Rate * float64(time.Second)))
+	default:
+		result.RetryAfter = time.Minute
+	}
+
+	return l.remaining(result, b, limit, now), nil
+}
+
+// bucket returns the bucket of key, applying limit to it. l.mu must be held.
+func (l *TokenBucket) bucket(key string, limit Limit, now time.Time) *bucket {
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.buckets[key] = b
+	} else {
+		if b.limiter.Limit() != rate.Limit(limit.Rate) {
+			b.limiter.SetLimitAt(now, rate.Limit(limit.Rate))
+		}
+		if b.limiter.Burst() != limit.Burst {
+			b.limiter.SetBurstAt(now, limit.Burst)
+		}
+	}
+
+	b.lastSeen = now
+
+	return b
+}
+
+func (l *TokenBucket) remaining(result Result, b *bucket, limit Limit, now time.Time) Result {
+	tokens := b.limiter.TokensAt(now)
+
+	result.Remaining = int(math.Max(0, math.Floor(tokens)))
+	if limit.Rate > 0 {
+		result.Reset = time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return result
+}
@@ -0,0 +1,190 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Store holds request counters for fixed windows, identified by the unix
+// time in nanoseconds each window starts at. Add applies delta to the counter
+// of the window starting at start and returns the count of that window and
+// any starting after it, together with the count of windows starting in the
+// length before it. Counters are summed by start time rather than matched by
+// window, so those written under another window length still count after a
+// limit change. Counters may be dropped after expiry.
+type Store interface {
+	Add(key string, start int64, length time.Duration, delta int64, expiry time.Time) (current int64, previous int64, err error)
+}
+
+// SlidingWindow approximates a sliding log by weighting the previous fixed
+// window by how much of it still overlaps the sliding one. All state lives
+// in the store, so replicas sharing a store share their limits.
+type SlidingWindow struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewSlidingWindow(store Store) *SlidingWindow {
+	return &SlidingWindow{store: store, now: time.Now}
+}
+
+func (l *SlidingWindow) Allow(key string, limit Limit) (Result, error) {
+	return l.take(key, limit, 1)
+}
+
+// Peek reports what Allow would return without counting a request.
+func (l *SlidingWindow) Peek(key string, limit Limit) (Result, error) {
+	return l.take(key, limit, 0)
+}
+
+// take counts delta requests, which is either one or none, and reports
+// whether one more fitted within the limit.
+func (l *SlidingWindow) take(key string, limit Limit, delta int64) (Result, error) {
+	result := Result{Limit: limit.Burst}
+
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		result.RetryAfter = time.Minute
+		return result, nil
+	}
+
+	// A window is as long as it takes the token bucket with the same limit
+	// to refill completely, so both allow the same sustained rate.
+	length := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+	if length < time.Second {
+		length = time.Second
+	}
+
+	now := l.now().UnixNano()
+	start := now - now%int64(length)
+	elapsed := time.Duration(now - start)
+	expiry := time.Unix(0, start+2*int64(length))
+
+	current, previous, err := l.store.Add(key, start, length, delta, expiry)
+	if err != nil {
+		return Result{}, err
+	}
+
+	weight := 1 - float64(elapsed)/float64(length)
+	count := float64(previous)*weight + float64(current)
+
+	if count+float64(1-delta) > float64(limit.Burst) {
+		// Denied requests give their slot back, as with the token bucket.
+		if delta > 0 {
+			current, previous, err = l.store.Add(key, start, length, -delta, expiry)
+			if err != nil {
+				return Result{}, err
+			}
+		}
+		result.RetryAfter = retryAfter(current, previous, limit.Burst, length, elapsed)
+	} else {
+		result.Allowed = true
+		result.Remaining = int(math.Floor(float64(limit.Burst) - count))
+	}
+
+	switch {
+	case current > 0:
+		result.Reset = 2*length - elapsed
+	case previous > 0:
+		result.Reset = length - elapsed
+	}
+
+	return result, nil
+}
+
+// retryAfter works out when the weighted count will have dropped far enough
+// for one more request to fit. It rounds up, since a caller retrying a
+// nanosecond early would be denied again.
+func retryAfter(current int64, previous int64, burst int, length time.Duration, elapsed time.Duration) time.Duration {
+	free := float64(burst - 1)
+
+	if float64(current) <= free && previous > 0 {
+		t := time.Duration(math.Ceil(float64(length)*(1-(free-float64(current))/float64(previous)))) - elapsed
+		if t > 0 {
+			return t
+		}
+		return time.Second
+	}
+
+	// The current window alone is full, so the earliest slot is in the
+	// next window once enough of this one has slid out.
+	wait := length - elapsed
+	if current > 0 {
+		wait += time.Duration(math.Ceil(float64(length) * math.Max(0, 1-free/float64(current))))
+	}
+
+	return wait
+}
+
+type memoryCounter struct {
+	count  int64
+	expiry time.Time
+}
+
+// MemoryStore is an in-process Store. It behaves like the Postgres store
+// and is meant for single instances and for checking the sliding window
+// without a database.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]map[int64]*memoryCounter
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		counters: make(map[string]map[int64]*memoryCounter),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			s.mu.Lock()
+			for key, windows := range s.counters {
+				for start, c := range windows {
+					if time.Now().After(c.expiry) {
+						delete(windows, start)
+					}
+				}
+				if len(windows) == 0 {
+					delete(s.counters, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	return s
+}
+
+func (s *MemoryStore) Add(key string, start int64, length time.Duration, delta int64, expiry time.Time) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, found := s.counters[key]
+	if !found {
+		windows = make(map[int64]*memoryCounter)
+		s.counters[key] = windows
+	}
+
+	c, found := windows[start]
+	if !found {
+		c = &memoryCounter{}
+		windows[start] = c
+	}
+
+	c.count += delta
+	if expiry.After(c.expiry) {
+		c.expiry = expiry
+	}
+
+	var current, previous int64
+	for windowStart, counter := range windows {
+		switch {
+		case windowStart >= start:
+			current += counter.count
+		case windowStart >= start-int64(length):
+			previous += counter.count
+		}
+	}
+
+	return current, previous, nil
+}
@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+type Mailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender *mail.Address
+}
+
+// New returns a mailer sending from sender, which may include a display
+// name such as "Rest <no-reply@rest.local>".
+func New(host string, port int, username string, password string, sender string) (Mailer, error) {
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return Mailer{}, fmt.Errorf("invalid smtp sender %q: %w", sender, err)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return Mailer{
+		addr:   fmt.Sprintf("%s:%d", host, port),
+		auth:   auth,
+		sender: from,
+	}, nil
+}
+
+// Send renders the "subject" and "plainBody" templates defined in
+// templateFile with data and mails the result to recipient.
+func (m Mailer) Send(recipient string, templateFile string, data interface{}) error {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", m.sender.String())
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(msg, "\r\n")
+	msg.Write(plainBody.Bytes())
+
+	return smtp.SendMail(m.addr, m.auth, m.sender.Address, []string{recipient}, msg.Bytes())
+}
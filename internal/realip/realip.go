@@ -0,0 +1,185 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The forwarding headers a Resolver can read.
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderForwarded     = "forwarded"
+)
+
+// Resolver works out the address of the client that made a request. The
+// forwarding header is only believed when it was added by one of the
+// trusted proxies, since anyone can send it.
+type Resolver struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// New parses a comma separated list of CIDRs or single IP addresses. header
+// names the one forwarding header the proxies set. The other is ignored,
+// because a proxy that doesn't set it passes the client's own copy through.
+func New(trustedProxies string, header string) (*Resolver, error) {
+	header = strings.ToLower(strings.TrimSpace(header))
+
+	switch header {
+	case HeaderXForwardedFor, HeaderForwarded:
+	default:
+		return nil, fmt.Errorf("unknown forwarding header %q", header)
+	}
+
+	trusted, err := ParseNetworks(strings.Split(trustedProxies, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{trusted: trusted, header: header}, nil
+}
+
+// ParseNetworks parses CIDRs, treating a bare IP address as a network of
+// one. Blank entries are skipped.
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Contains reports whether ip is in any of the networks.
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (res *Resolver) isTrusted(ip net.IP) bool {
+	return Contains(res.trusted, ip)
+}
+
+// ClientIP returns the client address. Hops are read right to left, the
+// nearest first, and the first address not belonging to a trusted proxy is
+// the client.
+func (res *Resolver) ClientIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	client := net.ParseIP(host)
+	if client == nil || !res.isTrusted(client) {
+		return host, nil
+	}
+
+	var hops []string
+	switch res.header {
+	case HeaderForwarded:
+		hops = parseForwarded(r.Header.Values("Forwarded"))
+	default:
+		hops = parseXForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Obfuscated or garbled entries can't be followed any further,
+			// so the last proxy that could be trusted is the best answer.
+			break
+		}
+
+		client = ip
+		if !res.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client.String(), nil
+}
+
+func parseXForwardedFor(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, stripPort(strings.TrimSpace(hop)))
+		}
+	}
+
+	return hops
+}
+
+// parseForwarded extracts the "for" parameter of every element of RFC 7239
+// Forwarded headers.
+func parseForwarded(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hop = stripPort(strings.Trim(val, `"`))
+			}
+
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// stripPort removes an optional port and the brackets around IPv6
+// addresses, as in "[2001:db8::1]:4711" or "192.0.2.1:80".
+func stripPort(hop string) string {
+	if strings.HasPrefix(hop, "[") {
+		if end := strings.Index(hop, "]"); end > 0 {
+			return hop[1:end]
+		}
+		return hop
+	}
+
+	if strings.Count(hop, ":") == 1 {
+		host, _, err := net.SplitHostPort(hop)
+		if err == nil {
+			return host
+		}
+	}
+
+	return hop
+}
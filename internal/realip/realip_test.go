@@ -0,0 +1,108 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		xff        string
+		forwarded  string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores headers",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "198.51.100.7:4000",
+			xff:        "203.0.113.9",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy appends to X-Forwarded-For",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "203.0.113.9",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "client-sent Forwarded is ignored when proxies set X-Forwarded-For",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "203.0.113.9",
+			forwarded:  "for=6.6.6.6",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "client-sent X-Forwarded-For entries left of the proxy are not believed",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "6.6.6.6, 203.0.113.9",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "chain of trusted proxies",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "203.0.113.9, 10.0.0.3",
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "client-sent X-Forwarded-For is ignored when proxies set Forwarded",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "6.6.6.6",
+			forwarded:  `for="[2001:db8::1]:4711"`,
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "trusted proxy without the configured header",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "6.6.6.6",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "garbled hop stops at the last trusted proxy",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.2:4000",
+			xff:        "203.0.113.9, unknown",
+			want:       "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := New("10.0.0.0/8", tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.forwarded != "" {
+				r.Header.Set("Forwarded", tt.forwarded)
+			}
+
+			got, err := res.ClientIP(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsUnknownHeader(t *testing.T) {
+	if _, err := New("", "x-real-ip"); err == nil {
+		t.Fatal("expected an error for an unsupported header")
+	}
+}
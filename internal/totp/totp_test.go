@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from RFC 6238, Appendix B.
+var rfcSecret = []byte("12345678901234567890")
+
+// RFC 6238, Appendix B lists 8-digit codes; with Digits = 6 the expected
+// codes are their last six digits.
+func TestCodeRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+			if got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Counter(now)
+
+	tests := []struct {
+		name        string
+		code        string
+		skew        int
+		wantOK      bool
+		wantCounter int64
+	}{
+		{"current step", Code(rfcSecret, current), 1, true, current},
+		{"previous step within skew", Code(rfcSecret, current-1), 1, true, current - 1},
+		{"next step within skew", Code(rfcSecret, current+1), 1, true, current + 1},
+		{"previous step without skew", Code(rfcSecret, current-1), 0, false, 0},
+		{"two steps back", Code(rfcSecret, current-2), 1, false, 0},
+		{"wrong code", "000000", 1, false, 0},
+		{"too short", "28708", 1, false, 0},
+		{"8-digit RFC code", "14050471", 1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || counter != tt.wantCounter {
+				t.Errorf("got (%d, %t); want (%d, %t)", counter, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Rest API", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("got %s://%s; want otpauth://totp", uri.Scheme, uri.Host)
+	}
+
+	if uri.Path != "/Rest API:alice@example.com" {
+		t.Errorf("got label %q", uri.Path)
+	}
+
+	query := uri.Query()
+	want := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "Rest API",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("%s: got %q; want %q", key, query.Get(key), value)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+create table if not exists idempotency_keys(
+    key text not null,
+    method text not null,
+    path text not null,
+    fingerprint bytea not null,
+    status integer,
+    header jsonb,
+    body bytea,
+    created_at timestamp(0) with time zone not null default now(),
+    expires_at timestamp(0) with time zone not null,
+    primary key (key, method, path)
+);
+
+create index if not exists idempotency_keys_expires_at_idx on idempotency_keys (expires_at);
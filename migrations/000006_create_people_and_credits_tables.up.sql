@@ -0,0 +1,21 @@
+create table if not exists people(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    name text not null,
+    birth_year integer,
+    version integer not null default 1
+);
+
+create table if not exists movie_credits(
+    id bigserial primary key,
+    movie_id bigint not null references movies on delete cascade,
+    person_id bigint not null references people on delete cascade,
+    role text not null,
+    billing_order integer not null default 0,
+    constraint movie_credits_role_check check ( role in ('director', 'actor', 'writer') ),
+    constraint movie_credits_billing_order_check check ( billing_order >= 0 ),
+    constraint movie_credits_movie_person_role_key unique (movie_id, person_id, role)
+);
+
+create index if not exists movie_credits_person_id_idx on movie_credits (person_id);
+create index if not exists people_name_idx on people using gin (to_tsvector('simple', name));
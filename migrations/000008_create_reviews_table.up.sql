@@ -0,0 +1,13 @@
+create table if not exists reviews(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    user_id bigint not null references users on delete cascade,
+    movie_id bigint not null references movies on delete cascade,
+    score integer not null,
+    body text not null default '',
+    version integer not null default 1,
+    constraint reviews_score_check check ( score between 1 and 10 ),
+    constraint reviews_user_movie_key unique (user_id, movie_id)
+);
+
+create index if not exists reviews_movie_id_idx on reviews (movie_id);
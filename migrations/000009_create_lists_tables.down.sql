@@ -0,0 +1,2 @@
+drop table if exists list_movies;
+drop table if exists lists;
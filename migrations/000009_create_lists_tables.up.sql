@@ -0,0 +1,20 @@
+create table if not exists lists(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    user_id bigint not null references users on delete cascade,
+    name text not null,
+    public bool not null default false,
+    version integer not null default 1
+);
+
+create index if not exists lists_user_id_idx on lists (user_id);
+
+create table if not exists list_movies(
+    list_id bigint not null references lists on delete cascade,
+    movie_id bigint not null references movies on delete cascade,
+    position integer not null,
+    added_at timestamp(0) with time zone not null default now(),
+    primary key (list_id, movie_id)
+);
+
+create index if not exists list_movies_movie_id_idx on list_movies (movie_id);
@@ -0,0 +1,2 @@
+drop table if exists users_permissions;
+drop table if exists permissions;
@@ -0,0 +1,13 @@
+create table if not exists api_keys(
+    id bigserial primary key,
+    created_at timestamp(0) with time zone not null default now(),
+    user_id bigint not null references users on delete cascade,
+    name text not null,
+    prefix text not null unique,
+    key_hash bytea not null unique,
+    scopes text[] not null default '{}',
+    expires_at timestamp(0) with time zone,
+    last_used_at timestamp(0) with time zone
+);
+
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
@@ -0,0 +1,4 @@
+drop table if exists mfa_recovery_codes;
+alter table users drop column if exists mfa_last_counter;
+alter table users drop column if exists mfa_enabled;
+alter table users drop column if exists mfa_secret;
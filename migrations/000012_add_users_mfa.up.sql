@@ -0,0 +1,12 @@
+alter table users add column if not exists mfa_secret bytea;
+alter table users add column if not exists mfa_enabled bool not null default false;
+alter table users add column if not exists mfa_last_counter bigint not null default 0;
+
+create table if not exists mfa_recovery_codes(
+    id bigserial primary key,
+    user_id bigint not null references users on delete cascade,
+    code_hash bytea not null,
+    used_at timestamp(0) with time zone
+);
+
+create index if not exists mfa_recovery_codes_user_id_idx on mfa_recovery_codes (user_id);
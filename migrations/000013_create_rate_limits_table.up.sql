@@ -0,0 +1,9 @@
+create unlogged table if not exists rate_limits(
+    key text not null,
+    window_start bigint not null,
+    count bigint not null default 0,
+    expires_at timestamp(0) with time zone not null,
+    primary key (key, window_start)
+);
+
+create index if not exists rate_limits_expires_at_idx on rate_limits (expires_at);
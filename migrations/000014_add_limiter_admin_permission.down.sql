@@ -0,0 +1 @@
+delete from permissions where code = 'limiter:admin';
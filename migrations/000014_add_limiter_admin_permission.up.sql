@@ -0,0 +1,3 @@
+insert into permissions (code)
+values ('limiter:admin')
+on conflict (code) do nothing;
@@ -0,0 +1,7 @@
+delete from idempotency_keys where scope <> '';
+
+alter table idempotency_keys drop constraint if exists idempotency_keys_pkey;
+alter table idempotency_keys add primary key (key, method, path);
+
+alter table idempotency_keys drop column if exists locked_at;
+alter table idempotency_keys drop column if exists scope;
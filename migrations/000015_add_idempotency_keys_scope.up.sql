@@ -0,0 +1,5 @@
+alter table idempotency_keys add column if not exists scope text not null default '';
+alter table idempotency_keys add column if not exists locked_at timestamp with time zone not null default now();
+
+alter table idempotency_keys drop constraint if exists idempotency_keys_pkey;
+alter table idempotency_keys add primary key (scope, key, method, path);
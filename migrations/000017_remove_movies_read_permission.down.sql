@@ -0,0 +1,3 @@
+insert into permissions (code)
+values ('movies:read')
+on conflict (code) do nothing;